@@ -17,8 +17,14 @@ function AwesomeCtrl($scope, output, $rootScope) {
             ctx: 'cmd',
             data: null
         },
+        msgTmplTty = {
+            ctx: 'tty',
+            data: null
+        },
         joinFn = Array.prototype.join,
         wsUri = "ws://localhost:12345/nvlv",
+        ssnToken = window.sessionStorage.getItem("nvlvSsn"),
+        authToken = window.sessionStorage.getItem("nvlvToken"),
         msglog = "";
 
 
@@ -37,11 +43,13 @@ function AwesomeCtrl($scope, output, $rootScope) {
 
 
     jsr.addCmd("-open", initNvlvConn);
+    jsr.addCmd("-token", setAuthToken);
     jsr.addCmd("-init", initGdbSsn);
     jsr.addCmd("-t", function(){ output.push('done'); $scope.$apply('refresh()');});
     jsr.addCmd("-", jsrSendCmd, true);
     jsr.addCmd("!", jsrSendSh, true);
     jsr.addCmd(":", jsrSendGdb, true);
+    jsr.addCmd(">", jsrSendTty, true);
     jsr.addSnippet(": /_assets/tools/gdb/gdb-7.5/build/gdb/gdb --interpreter mi dev_0");
     jsr.addSnippet(": source /usr/local/go/src/pkg/runtime/runtime-gdb.py");
 
@@ -72,6 +80,11 @@ function AwesomeCtrl($scope, output, $rootScope) {
         doSend(JSON.stringify(msgTmplGdb), true);
     }
 
+    function jsrSendTty() {
+        msgTmplTty.data = {input: joinFn.call(arguments, [' ']) + '\n'};
+        doSend(JSON.stringify(msgTmplTty), true);
+    }
+
     function outputAppend(data) {
         // output.unshift(data);
         $scope.noop();
@@ -86,8 +99,22 @@ function AwesomeCtrl($scope, output, $rootScope) {
 
     
 
+    // the token the server was started to accept, see -token-file
+    function setAuthToken(token) {
+        authToken = token;
+        window.sessionStorage.setItem("nvlvToken", token);
+    }
+
     function initNvlvConn() {
-        websocket = new WebSocket(wsUri);
+        // reattach to the session after a refresh or a dropped connection
+        var params = [];
+        if (ssnToken) {
+            params.push("ssn=" + encodeURIComponent(ssnToken));
+        }
+        if (authToken) {
+            params.push("token=" + encodeURIComponent(authToken));
+        }
+        websocket = new WebSocket(params.length ? wsUri + "?" + params.join("&") : wsUri);
         websocket.onopen = onOpen;
         websocket.onclose = onClose;
         websocket.onerror = onError;
@@ -138,6 +165,10 @@ function AwesomeCtrl($scope, output, $rootScope) {
         }
         data = data.Data;
 
+        if (data.ssn !== undefined) {
+            ssnToken = data.ssn;
+            window.sessionStorage.setItem("nvlvSsn", ssnToken);
+        }
         if (data.err !== undefined) {
             jsr.deep(data.err);
             outputAppend('error: -------------- \n' + data.err);
@@ -2,18 +2,60 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/tiffon/nvlv/svr"
+	"log"
+	"time"
 )
 
-// Port to listen on
-var WebSockPort string
-
-// Local dir for session related data
-var SessionStorageDir string
-
 func main() {
-	flag.StringVar(&WebSockPort, "websocket-port", ":12345", "nvlv server websocket port number")
-	flag.StringVar(&SessionStorageDir, "session-dir", "/data/nvlv", "local dir for session related data")
+	cfg := &svr.Config{}
+	var configFile string
+
+	flag.StringVar(&configFile, "config", "", "JSON config file keyed by flag name, flags given on the command line take precedence")
+	flag.StringVar(&cfg.Port, "websocket-port", ":12345", "nvlv server address, loopback only when it has no host, other hosts need -token-file or -hmac-key-file")
+	flag.StringVar(&cfg.SessionDir, "session-dir", "/data/nvlv", "local dir for session related data")
+	flag.StringVar(&cfg.GdbPath, "gdb", "", "gdb binary, looked up on the PATH when empty")
+	flag.StringVar(&cfg.RuntimeGdbPy, "runtime-gdb-py", "", "Go runtime-gdb.py support script, found with 'go env GOROOT' when empty")
+	flag.StringVar(&cfg.GdbServer, "gdbserver", "", "gdbserver binary for -gdb-serve, looked up on the PATH when empty")
+	flag.StringVar(&cfg.ReconnectGrace, "reconnect-grace", "1m", "how long a session waits for its client to reconnect before it ends")
+	flag.StringVar(&cfg.Dap, "dap", "", "serve the Debug Adapter Protocol on this TCP address, loopback only when it has no host, or on stdin and stdout with 'stdio'")
+	flag.StringVar(&cfg.TokenFile, "token-file", "", "file of accepted tokens, one per line optionally followed by a name")
+	flag.StringVar(&cfg.HmacKeyFile, "hmac-key-file", "", "key file for HMAC-signed tokens, see -sign-token")
+	flag.StringVar(&cfg.AllowedOrigins, "allowed-origins", "", "comma separated origins browsers may connect from besides the server's own")
+	var signName string
+	var signTtl time.Duration
+	flag.StringVar(&signName, "sign-token", "", "print a token for this name signed with -hmac-key-file and exit")
+	flag.DurationVar(&signTtl, "token-ttl", 24*time.Hour, "how long a token from -sign-token is good for, 0 for no expiry")
 	flag.Parse()
-	svr.Start(SessionStorageDir, WebSockPort)
+
+	if len(configFile) > 0 {
+		given := make(map[string]string)
+		flag.Visit(func(f *flag.Flag) {
+			given[f.Name] = f.Value.String()
+		})
+		if err := svr.LoadConfig(configFile, cfg); err != nil {
+			log.Fatal(err)
+		}
+		for name, v := range given {
+			flag.Set(name, v)
+		}
+	}
+	if len(signName) > 0 {
+		key, err := svr.LoadHmacKey(cfg.HmacKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var expires time.Time
+		if signTtl > 0 {
+			expires = time.Now().Add(signTtl)
+		}
+		token, err := svr.SignToken(key, signName, expires)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(token)
+		return
+	}
+	svr.Start(cfg)
 }
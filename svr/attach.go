@@ -0,0 +1,96 @@
+package svr
+
+import (
+	"context"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/cmn"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"log"
+	"strconv"
+	"time"
+)
+
+// How long detaching may take when the session ends.
+var detachTimeout = 5 * time.Second
+
+// Replies to -proc-list with the processes that can be attached to.
+func handleProcList(ssn *nvlvSsn) {
+	procs, err := cmn.ListProcs()
+	if err != nil {
+		ssn.cmdMsgBody.sendErr(ssn.ws, err, "cmd", "-proc-list")
+		return
+	}
+	ssn.cmdMsgBody.send(ssn.ws, "-proc-list", procs)
+}
+
+// Handles the admin commands for debugging a process that is already
+// running:
+//
+//	-gdb-attach <pid>
+//	-gdb-detach
+//
+// Attach and detach reply with the resulting target, later changes are
+// sent on the gdb ctx as "target".
+func handleAttachCmd(t *gdbTarget, adminCmd string, msg *clientBody) {
+
+	args := msg.args()
+	switch adminCmd {
+
+	case "-gdb-attach":
+		if len(args) != 1 {
+			t.cmdMsgBody.sendErr(t.ssn.ws, badRequest("argument error: expected a pid"), "cmd", adminCmd)
+			return
+		}
+		pid, err := strconv.Atoi(args[0])
+		if err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, badRequest("argument error: %v", err), "cmd", adminCmd)
+			return
+		}
+		// no executable is needed, the GDB finds it from the pid
+		if !t.gdbSsn.IsStarted() {
+			if err = t.gdbSsn.StartContext(t.ctx, ""); err != nil {
+				t.cmdMsgBody.sendErr(t.ssn.ws, fmt.Errorf("Err: Unable to start gdb ssn: %w", err), "cmd", adminCmd)
+				return
+			}
+		}
+		// attaching can take a while when the process is large
+		g := t.gdbSsn
+		req := t.ssn.ws.req
+		go func() {
+			ctx, cancel := context.WithTimeout(t.ssn.ctx, threadsTimeout)
+			err := g.Attach(ctx, pid)
+			cancel()
+			t.ssn.laterReply(req, func() {
+				if err != nil {
+					t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+					return
+				}
+				t.cmdMsgBody.send(t.ssn.ws, adminCmd, g.Target())
+			})
+		}()
+
+	case "-gdb-detach":
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+		err := t.gdbSsn.Detach(ctx)
+		cancel()
+		if err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+			return
+		}
+		t.cmdMsgBody.send(t.ssn.ws, adminCmd, t.gdbSsn.Target())
+	}
+}
+
+// Lets an attached process go on running when the session ends rather
+// than leaving it stopped or killing it along with the GDB. The session
+// ctx may be done by now, the GDB's is not.
+func (t *gdbTarget) detachOnEnd() {
+	if !t.gdbSsn.IsStarted() || t.gdbSsn.IsKilled() || t.gdbSsn.Target().Mode != gdb.MODE_ATTACH {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), detachTimeout)
+	defer cancel()
+	if err := t.gdbSsn.Detach(ctx); err != nil {
+		log.Println("Err: Unable to detach: ", err)
+	}
+}
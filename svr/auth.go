@@ -0,0 +1,330 @@
+package svr
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/go.net/websocket"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Who may connect. With neither a token file nor an HMAC key anyone who
+// can reach the port gets in, and with that a shell, so the server then
+// only listens on loopback, see listenAddr.
+var (
+	// Static tokens from the token file, by token.
+	authTokens map[string]string
+	// The key HMAC-signed tokens are checked with, see SignToken.
+	authHmacKey []byte
+	// The origins browsers may connect from, besides the server's own.
+	allowedOrigins map[string]bool
+)
+
+var (
+	errNoToken = &protoError{codeUnauthorized,
+		"no token given, send it as 'Authorization: Bearer <token>' or ?token="}
+	errBadToken = &protoError{codeUnauthorized, "invalid token"}
+)
+
+type identityKey struct{}
+
+// Loads the token file and HMAC key and parses the allowed origins.
+func loadAuth(cfg *Config) error {
+
+	if len(cfg.TokenFile) > 0 {
+		tokens, err := loadTokenFile(cfg.TokenFile)
+		if err != nil {
+			return err
+		}
+		authTokens = tokens
+	}
+	if len(cfg.HmacKeyFile) > 0 {
+		key, err := LoadHmacKey(cfg.HmacKeyFile)
+		if err != nil {
+			return err
+		}
+		authHmacKey = key
+	}
+	allowedOrigins = make(map[string]bool)
+	for _, o := range strings.Split(cfg.AllowedOrigins, ",") {
+		if o = strings.TrimSpace(o); len(o) > 0 {
+			allowedOrigins[strings.TrimSuffix(o, "/")] = true
+		}
+	}
+	return nil
+}
+
+func authEnabled() bool {
+	return authTokens != nil || authHmacKey != nil
+}
+
+// Reads a token file, one token per line optionally followed by the
+// name it is recorded as. Blank lines and lines starting with # are
+// skipped.
+func loadTokenFile(file string) (map[string]string, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		name := fmt.Sprintf("token-%d", n)
+		if len(fields) > 1 {
+			name = fields[1]
+		}
+		tokens[fields[0]] = name
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens in %s", file)
+	}
+	return tokens, nil
+}
+
+// Reads the key for HMAC-signed tokens, surrounding whitespace is
+// dropped.
+func LoadHmacKey(file string) ([]byte, error) {
+	bts, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(bts)
+	if len(key) < 16 {
+		return nil, fmt.Errorf("the key in %s is too short, use at least 16 bytes", file)
+	}
+	return key, nil
+}
+
+// Returns a token for name that is good until expires, or for good when
+// expires is zero: <name>:<unix expiry>:<hex HMAC-SHA256 of the rest>.
+func SignToken(key []byte, name string, expires time.Time) (string, error) {
+	if len(name) == 0 || strings.Contains(name, ":") {
+		return "", fmt.Errorf("invalid token name %q", name)
+	}
+	var exp int64
+	if !expires.IsZero() {
+		exp = expires.Unix()
+	}
+	payload := name + ":" + strconv.FormatInt(exp, 10)
+	return payload + ":" + hex.EncodeToString(tokenMac(key, payload)), nil
+}
+
+func tokenMac(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Returns the name of an HMAC-signed token.
+func checkSignedToken(key []byte, token string) (string, error) {
+
+	parts := strings.Split(token, ":")
+	if len(parts) != 3 {
+		return "", errBadToken
+	}
+	sig, err := hex.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, tokenMac(key, parts[0]+":"+parts[1])) {
+		return "", errBadToken
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", errBadToken
+	}
+	if exp != 0 && time.Now().Unix() > exp {
+		return "", &protoError{codeUnauthorized, "token expired"}
+	}
+	return parts[0], nil
+}
+
+// Returns who sent r, "" when auth is off.
+func authenticate(r *http.Request) (string, error) {
+
+	if !authEnabled() {
+		return "", nil
+	}
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if len(token) == 0 {
+		return "", errNoToken
+	}
+	return checkToken(token)
+}
+
+// Returns the name of a static or HMAC-signed token.
+func checkToken(token string) (string, error) {
+
+	// every static token is compared so the time taken gives nothing away
+	name := ""
+	for t, n := range authTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			name = n
+		}
+	}
+	if len(name) > 0 {
+		return name, nil
+	}
+	if authHmacKey != nil {
+		return checkSignedToken(authHmacKey, token)
+	}
+	return "", errBadToken
+}
+
+// Checks the Origin of a browser request: it has to be the server itself
+// or one of the allowed origins. Requests without one are not from a
+// browser and only need a token. With auth off the server itself only
+// counts under a loopback name, a page whose name was rebound to the
+// server's address would pass as the server itself otherwise, and the
+// Host has to be one as well since same origin GETs carry no Origin.
+func checkOrigin(r *http.Request) error {
+
+	origin := r.Header.Get("Origin")
+	if !authEnabled() && !isLoopbackHost(r.Host) && !allowedHost(r.Host) {
+		return &protoError{codeForbidden, "host not allowed: " + r.Host}
+	}
+	if len(origin) == 0 || allowedOrigins[strings.TrimSuffix(origin, "/")] {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err == nil && u.Host == r.Host && (authEnabled() || isLoopbackHost(u.Host)) {
+		return nil
+	}
+	return &protoError{codeForbidden, "origin not allowed: " + origin}
+}
+
+// Whether host, with or without a port, is localhost or a loopback
+// address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Whether host is the host of one of the allowed origins.
+func allowedHost(host string) bool {
+	for o := range allowedOrigins {
+		if u, err := url.Parse(o); err == nil && u.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the address to listen on for addr, a TCP address: loopback
+// when it has no host. Without auth only loopback addresses are allowed.
+func listenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if len(host) == 0 {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if !authEnabled() && !isLoopbackHost(host) {
+		return "", fmt.Errorf("refusing to listen on %s without a token file or HMAC key, "+
+			"anyone who could connect would get a shell", addr)
+	}
+	return addr, nil
+}
+
+// Wraps the handlers of the websocket, REST and SSE endpoints. Rejects
+// requests from other origins and without a valid token, the identity
+// of the others is kept in the request's context. DAP clients send
+// their token in the protocol, see dapSsn.authenticate.
+func guard(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkOrigin(r); err != nil {
+			log.Println("rejected:", r.RemoteAddr, err)
+			restErr(w, err)
+			return
+		}
+		name, err := authenticate(r)
+		if err != nil {
+			log.Println("rejected:", r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			restErr(w, err)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, name)))
+	})
+}
+
+// The websocket server, origins are checked by guard so clients that
+// send none, which websocket.Handler refuses, get in as well.
+func wsServer() websocket.Server {
+	return websocket.Server{
+		Handler: connHandler,
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			config.Origin, _ = websocket.Origin(config, r)
+			return nil
+		},
+	}
+}
+
+// Returns who sent r, as found by guard.
+func identityOf(r *http.Request) string {
+	name, _ := r.Context().Value(identityKey{}).(string)
+	return name
+}
+
+// Whether the client named by identity may use the session, only its
+// creator can when auth is on.
+func (ssn *nvlvSsn) allows(identity string) bool {
+	return ssn.owner == identity
+}
+
+var clientLogMtx = &sync.Mutex{}
+
+// Appends who did what to the session to clients.log in its dir.
+func (ssn *nvlvSsn) recordClient(what string, r *http.Request) {
+
+	name := identityOf(r)
+	if len(name) == 0 {
+		name = "-"
+	}
+	line := fmt.Sprintf("%s %s identity=%s remote=%s origin=%q\n",
+		time.Now().Format(time.RFC3339), what, name, r.RemoteAddr, r.Header.Get("Origin"))
+
+	clientLogMtx.Lock()
+	defer clientLogMtx.Unlock()
+	file := ssn.dir + string(os.PathSeparator) + "clients.log"
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Println("Err: Unable to record client: ", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.WriteString(line); err != nil {
+		log.Println("Err: Unable to record client: ", err)
+	}
+}
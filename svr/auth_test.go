@@ -0,0 +1,118 @@
+package svr
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+func TestSignedToken(t *testing.T) {
+
+	for _, exp := range []time.Time{{}, time.Now().Add(time.Hour)} {
+		token, err := SignToken(testKey, "alice", exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name, err := checkSignedToken(testKey, token); err != nil || name != "alice" {
+			t.Errorf("checkSignedToken(%q) = %q, %v", token, name, err)
+		}
+	}
+
+	token, _ := SignToken(testKey, "alice", time.Time{})
+	other, _ := SignToken([]byte("fedcba9876543210"), "alice", time.Time{})
+	bad := []string{
+		"",
+		"alice",
+		strings.Replace(token, "alice", "bob", 1),
+		strings.Replace(token, ":0:", ":1:", 1),
+		token[:len(token)-1] + "x",
+		other,
+	}
+	for _, tok := range bad {
+		if _, err := checkSignedToken(testKey, tok); err != errBadToken {
+			t.Errorf("checkSignedToken(%q): got %v, want errBadToken", tok, err)
+		}
+	}
+
+	expired, _ := SignToken(testKey, "alice", time.Now().Add(-time.Minute))
+	if _, err := checkSignedToken(testKey, expired); err == nil || err == errBadToken {
+		t.Errorf("expired token: got %v", err)
+	}
+
+	for _, name := range []string{"", "a:b"} {
+		if _, err := SignToken(testKey, name, time.Time{}); err == nil {
+			t.Errorf("SignToken(%q): expected an error", name)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+
+	defer func(k []byte, o map[string]bool) { authHmacKey, allowedOrigins = k, o }(authHmacKey, allowedOrigins)
+	allowedOrigins = map[string]bool{"https://ui.example.com": true}
+
+	tests := []struct {
+		auth   bool
+		host   string
+		origin string
+		ok     bool
+	}{
+		{false, "localhost:8080", "", true},
+		{false, "127.0.0.1:8080", "http://127.0.0.1:8080", true},
+		{false, "[::1]:8080", "http://[::1]:8080", true},
+		{false, "localhost:8080", "https://ui.example.com/", true},
+		{false, "localhost:8080", "http://evil.example.com", false},
+		// a name rebound to the server's address
+		{false, "evil.example.com:8080", "http://evil.example.com:8080", false},
+		{false, "evil.example.com:8080", "", false},
+		{false, "ui.example.com", "https://ui.example.com", true},
+		{true, "nvlv.example.com:8080", "http://nvlv.example.com:8080", true},
+		{true, "nvlv.example.com:8080", "", true},
+		{true, "nvlv.example.com:8080", "http://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		authHmacKey = nil
+		if tt.auth {
+			authHmacKey = testKey
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = tt.host
+		if len(tt.origin) > 0 {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if err := checkOrigin(r); (err == nil) != tt.ok {
+			t.Errorf("auth %v, host %q, origin %q: got %v", tt.auth, tt.host, tt.origin, err)
+		}
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+
+	defer func(k []byte) { authHmacKey = k }(authHmacKey)
+	authHmacKey = nil
+
+	tests := []struct {
+		auth     bool
+		in, want string
+	}{
+		{false, ":8080", "127.0.0.1:8080"},
+		{false, "localhost:8080", "localhost:8080"},
+		{false, "0.0.0.0:8080", ""},
+		{true, ":8080", "127.0.0.1:8080"},
+		{true, "0.0.0.0:8080", "0.0.0.0:8080"},
+		{false, "8080", ""},
+	}
+	for _, tt := range tests {
+		authHmacKey = nil
+		if tt.auth {
+			authHmacKey = testKey
+		}
+		got, err := listenAddr(tt.in)
+		if (err != nil) != (len(tt.want) == 0) || got != tt.want {
+			t.Errorf("auth %v, listenAddr(%q) = %q, %v", tt.auth, tt.in, got, err)
+		}
+	}
+}
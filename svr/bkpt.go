@@ -0,0 +1,91 @@
+package svr
+
+import (
+	"context"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"strconv"
+	"strings"
+)
+
+// Handles the -bp-* admin commands. Each command replies with the
+// resulting breakpoint list keyed by the command name, e.g.
+//
+//	{cmd: "-bp-add", args: ["main.main"], condition: "i > 5"}
+func handleBpCmd(t *gdbTarget, adminCmd string, msg *clientBody) {
+
+	args := msg.args()
+	bps := t.gdbSsn.Breakpoints()
+	ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+	defer cancel()
+
+	var err error
+	switch adminCmd {
+
+	case "-bp-add":
+		if len(args) == 0 {
+			err = badRequest("argument error: no location given")
+			break
+		}
+		opts := bpOpts(msg.Data)
+		for _, loc := range args {
+			if _, err = bps.Insert(ctx, loc, opts); err != nil {
+				break
+			}
+		}
+
+	case "-bp-delete":
+		err = bps.Delete(ctx, args...)
+
+	case "-bp-enable":
+		err = bps.Enable(ctx, args...)
+
+	case "-bp-disable":
+		err = bps.Disable(ctx, args...)
+
+	case "-bp-condition":
+		if len(args) == 0 {
+			err = badRequest("argument error: no breakpoint given")
+			break
+		}
+		err = bps.Condition(ctx, args[0], strings.Join(args[1:], " "))
+
+	case "-bp-after":
+		if len(args) != 2 {
+			err = badRequest("argument error: expected breakpoint and count")
+			break
+		}
+		var count int
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			err = badRequest("argument error: invalid count %q", args[1])
+			break
+		}
+		err = bps.After(ctx, args[0], count)
+
+	case "-bp-list":
+		err = bps.Refresh(ctx)
+	}
+
+	t.saveExeSettings()
+	if err != nil {
+		t.cmdMsgBody.sendErr(t.ssn.ws, err, adminCmd, bps.List())
+		return
+	}
+	t.cmdMsgBody.send(t.ssn.ws, adminCmd, bps.List())
+}
+
+// Reads the -break-insert options sent along with -bp-add.
+func bpOpts(data map[string]interface{}) *gdb.BreakpointOpts {
+	opts := &gdb.BreakpointOpts{}
+	opts.Temporary, _ = data["temporary"].(bool)
+	opts.Hardware, _ = data["hardware"].(bool)
+	opts.Disabled, _ = data["disabled"].(bool)
+	opts.Condition, _ = data["condition"].(string)
+	if n, ok := data["ignore"].(float64); ok {
+		opts.Ignore = int(n)
+	}
+	if v, ok := data["thread"]; ok {
+		opts.Thread = fmt.Sprintf("%v", v)
+	}
+	return opts
+}
@@ -2,9 +2,12 @@ package cmn
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"io"
 	"os/exec"
+	"sync"
+	"syscall"
 )
 
 type CmdMsg struct {
@@ -19,6 +22,18 @@ type CmdWrapper struct {
 	errchan chan *CmdMsg
 	started bool
 	killed  bool
+	mtx     *sync.Mutex
+	cancel  context.CancelFunc
+	done    <-chan struct{}
+	exited  chan struct{}
+	exit    *ExitStatus
+}
+
+// How a command ended.
+type ExitStatus struct {
+	Code   int    `json:"exit-code"`
+	Signal string `json:"signal,omitempty"`
+	Err    string `json:"error,omitempty"`
 }
 
 func NewCmdWrapper(cmd *exec.Cmd) *CmdWrapper {
@@ -29,6 +44,11 @@ func NewCmdWrapper(cmd *exec.Cmd) *CmdWrapper {
 		make(chan *CmdMsg),
 		false,
 		false,
+		&sync.Mutex{},
+		nil,
+		nil,
+		make(chan struct{}),
+		nil,
 	}
 }
 
@@ -49,14 +69,50 @@ func (c *CmdWrapper) ErrChan() <-chan *CmdMsg {
 }
 
 func (c *CmdWrapper) IsStarted() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 	return c.started
 }
 
+// True once Kill was called, which happens on its own when the context
+// the command was started with is done.
 func (c *CmdWrapper) IsKilled() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 	return c.killed
 }
 
+// Closed once the command is killed or the context it was started
+// with is done. Nil before the command is started.
+func (c *CmdWrapper) Done() <-chan struct{} {
+	return c.done
+}
+
+// Closed once the process has ended and been waited on, after which
+// ExitStatus is available.
+func (c *CmdWrapper) Exited() <-chan struct{} {
+	return c.exited
+}
+
+func (c *CmdWrapper) ExitStatus() *ExitStatus {
+	select {
+	case <-c.exited:
+		return c.exit
+	default:
+		return nil
+	}
+}
+
 func (c *CmdWrapper) Start() error {
+	return c.StartContext(context.Background())
+}
+
+// Starts the command. When ctx is done the process is killed and the
+// goroutines feeding the channels exit.
+func (c *CmdWrapper) StartContext(ctx context.Context) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
 	if c.started {
 		return errors.New("Cmd already started")
 	}
@@ -79,32 +135,87 @@ func (c *CmdWrapper) Start() error {
 	if err != nil {
 		return err
 	}
-	go pipeReadLoop(outPipe, c.outchan)
-	go pipeReadLoop(errPipe, c.errchan)
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = ctx.Done()
+
+	// Wait must not be called before the pipes are read to the end
+	reading := &sync.WaitGroup{}
+	reading.Add(2)
+	go func() {
+		pipeReadLoop(ctx, outPipe, c.outchan)
+		reading.Done()
+	}()
 	go func() {
+		pipeReadLoop(ctx, errPipe, c.errchan)
+		reading.Done()
+	}()
+	go func() {
+		reading.Wait()
+		c.exit = exitStatus(c.cmd.Wait(), c.cmd)
+		close(c.exited)
+	}()
+	go func() {
+		defer inPipe.Close()
 		for {
 			select {
 			case s := <-c.inchan:
 				inPipe.Write([]byte(s + "\n"))
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
+	go func() {
+		<-ctx.Done()
+		c.Kill()
+	}()
 	c.started = true
 	return nil
 }
 
-func (c *CmdWrapper) KillRelease() {
+// Kills the process and stops the goroutines started with it. Safe to
+// call more than once. The process is reaped in the background, see
+// Exited.
+func (c *CmdWrapper) Kill() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.started || c.killed {
+		return
+	}
 	c.cmd.Process.Kill()
-	c.cmd.Process.Release()
 	c.killed = true
+	c.cancel()
 }
 
-func pipeReadLoop(pipe io.ReadCloser, resutlChan chan *CmdMsg) {
+func exitStatus(err error, cmd *exec.Cmd) *ExitStatus {
+	st := &ExitStatus{}
+	if err != nil {
+		st.Err = err.Error()
+	}
+	ps := cmd.ProcessState
+	if ps == nil {
+		st.Code = -1
+		return st
+	}
+	st.Code = ps.ExitCode()
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		st.Signal = ws.Signal().String()
+	}
+	return st
+}
+
+func pipeReadLoop(ctx context.Context, pipe io.ReadCloser, resutlChan chan *CmdMsg) {
 	rdr := bufio.NewReader(pipe)
-	line, err := rdr.ReadString('\n')
-	for err == nil {
-		resutlChan <- &CmdMsg{line, nil}
-		line, err = rdr.ReadString('\n')
+	for {
+		line, err := rdr.ReadString('\n')
+		select {
+		case resutlChan <- &CmdMsg{line, err}:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
 	}
-	resutlChan <- &CmdMsg{line, err}
 }
@@ -0,0 +1,78 @@
+package cmn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A process as found in /proc.
+type Proc struct {
+	Pid     int    `json:"pid"`
+	PPid    int    `json:"ppid"`
+	Uid     int    `json:"uid"`
+	Name    string `json:"name"`
+	Exe     string `json:"exe,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+// Lists the processes visible in /proc ordered by pid. Processes that
+// end while being read are left out, as are details that can't be read,
+// e.g. the exe of another user's process.
+func ListProcs() ([]*Proc, error) {
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]*Proc, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if p, err := readProc(pid); err == nil {
+			procs = append(procs, p)
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].Pid < procs[j].Pid
+	})
+	return procs, nil
+}
+
+func readProc(pid int) (*Proc, error) {
+
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	status, err := ioutil.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	p := &Proc{Pid: pid}
+	for _, line := range strings.Split(string(status), "\n") {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(line[i+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		switch line[:i] {
+		case "Name":
+			p.Name = strings.Join(fields, " ")
+		case "PPid":
+			p.PPid, _ = strconv.Atoi(fields[0])
+		case "Uid":
+			p.Uid, _ = strconv.Atoi(fields[0])
+		}
+	}
+	p.Exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+	if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.Cmdline = strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+	}
+	return p, nil
+}
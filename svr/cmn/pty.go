@@ -0,0 +1,41 @@
+package cmn
+
+import (
+	"errors"
+	"os"
+)
+
+var ErrPtyUnsupported = errors.New("pty: not supported on this platform")
+
+// A pseudo-terminal. The program being debugged is given the slave side
+// via its path, the server reads and writes the master side. The slave
+// is also held open by the server so reading the master doesn't fail
+// with EIO while no program has it open, e.g. between runs.
+type Pty struct {
+	Master    *os.File
+	SlavePath string
+	slave     *os.File
+}
+
+// Opens a new pseudo-terminal.
+func OpenPty() (*Pty, error) {
+
+	master, path, err := openPtyMaster()
+	if err != nil {
+		return nil, err
+	}
+	slave, err := os.OpenFile(path, os.O_RDWR|noCtty, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	return &Pty{master, path, slave}, nil
+}
+
+func (p *Pty) Close() error {
+	err := p.Master.Close()
+	if e := p.slave.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cmn
+
+import (
+	"os"
+)
+
+const noCtty = 0
+
+func openPtyMaster() (*os.File, string, error) {
+	return nil, "", ErrPtyUnsupported
+}
@@ -0,0 +1,39 @@
+package svr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Server settings, set with flags in cmd/startSvr.go or a JSON config
+// file using the flag names as keys.
+type Config struct {
+	Port         string `json:"websocket-port"`
+	SessionDir   string `json:"session-dir"`
+	GdbPath      string `json:"gdb"`
+	RuntimeGdbPy string `json:"runtime-gdb-py"`
+	GdbServer    string `json:"gdbserver"`
+	// A duration like "90s", see time.ParseDuration.
+	ReconnectGrace string `json:"reconnect-grace"`
+	// A TCP address to serve the Debug Adapter Protocol on, loopback
+	// when it has no host, or "stdio".
+	Dap string `json:"dap"`
+	// Auth, see loadAuth. AllowedOrigins is a comma separated list.
+	TokenFile      string `json:"token-file"`
+	HmacKeyFile    string `json:"hmac-key-file"`
+	AllowedOrigins string `json:"allowed-origins"`
+}
+
+// Overlays the values in a JSON config file on cfg. Keys not in the
+// file keep their current value.
+func LoadConfig(file string, cfg *Config) error {
+	bts, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(bts, cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", file, err)
+	}
+	return nil
+}
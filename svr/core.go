@@ -0,0 +1,58 @@
+package svr
+
+import (
+	"context"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+)
+
+// The crash state of a core file.
+type coreView struct {
+	Target     gdb.Target       `json:"target"`
+	Threads    []*gdb.Thread    `json:"threads"`
+	Goroutines []*gdb.Goroutine `json:"goroutines"`
+	Errors     []string         `json:"errors,omitempty"`
+}
+
+// Handles -gdb-load-core <exe> <core>. Starts the GDB on exe, loads the
+// core and replies with the threads and goroutines at the time of the
+// crash. Run and exec commands fail from then on.
+func handleLoadCore(t *gdbTarget, msg *clientBody) {
+
+	const adminCmd = "-gdb-load-core"
+	args := msg.args()
+	if len(args) != 2 {
+		t.cmdMsgBody.sendErr(t.ssn.ws, badRequest("argument error: expected an executable and a core file"), "cmd", adminCmd)
+		return
+	}
+	if err := t.gdbSsn.StartContext(t.ctx, args[0]); err != nil {
+		t.cmdMsgBody.sendErr(t.ssn.ws, fmt.Errorf("Err: Unable to start gdb ssn: %w", err), "cmd", adminCmd)
+		return
+	}
+
+	// collecting every stack and goroutine of a large core takes a while
+	g := t.gdbSsn
+	req := t.ssn.ws.req
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, threadsTimeout)
+		defer cancel()
+
+		if err := g.LoadCore(ctx, args[1]); err != nil {
+			t.ssn.laterReply(req, func() {
+				t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+			})
+			return
+		}
+		view := &coreView{Target: g.Target()}
+		var err error
+		if view.Threads, err = getThreadsWithBt(ctx, g); err != nil {
+			view.Errors = append(view.Errors, err.Error())
+		}
+		if view.Goroutines, err = g.GetGoroutines(ctx, true); err != nil {
+			view.Errors = append(view.Errors, err.Error())
+		}
+		t.ssn.laterReply(req, func() {
+			t.cmdMsgBody.send(t.ssn.ws, adminCmd, view)
+		})
+	}()
+}
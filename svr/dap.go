@@ -0,0 +1,823 @@
+package svr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The Debug Adapter Protocol, for editors that speak it rather than the
+// websocket protocol. Each connection, or stdin and stdout, gets a DAP
+// session with its own GDB. See
+// https://microsoft.github.io/debug-adapter-protocol/specification
+
+// Serves DAP on addr, a TCP address like "127.0.0.1:4711", or on stdin
+// and stdout when addr is "stdio", in which case it returns when the
+// client is done. The TCP address is checked by listenAddr like the
+// server's. With auth on TCP clients have to send a token, see
+// dapSsn.authenticate.
+func serveDap(addr string) error {
+
+	if addr == "stdio" {
+		d := newDapSsn(os.Stdin, os.Stdout)
+		// whoever started the server is the client
+		d.authed = true
+		return d.run()
+	}
+	addr, err := listenAddr(addr)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := newDapSsn(conn, conn).run(); err != nil {
+				log.Println("dap session ended: ", err)
+			}
+			conn.Close()
+		}()
+	}
+}
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Id       int    `json:"id,omitempty"`
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type dapThread struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type dapStackFrame struct {
+	Id     int        `json:"id"`
+	Name   string     `json:"name"`
+	Source *dapSource `json:"source,omitempty"`
+	Line   int        `json:"line"`
+	Column int        `json:"column"`
+}
+
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// A frame handed to the client by stackTrace.
+type dapFrame struct {
+	threadId string
+	level    int
+}
+
+// Variables handed to the client, either the locals of a frame or the
+// children of a variable object.
+type dapVarRef struct {
+	frame  dapFrame
+	varObj string
+}
+
+// A DAP client and its GDB. Requests are handled one at a time by run,
+// the GDB's output and stops are sent as events by forward.
+type dapSsn struct {
+	in     *bufio.Reader
+	out    io.Writer
+	outMtx *sync.Mutex
+	seq    int
+	gdbSsn *gdb.Ssn
+	gdbErr chan error
+	// Set by launch, the program is run on configurationDone.
+	launch *gdb.Launch
+	// The GDB breakpoint numbers set for each source by setBreakpoints,
+	// function breakpoints are under "".
+	bkpts map[string][]string
+	// Handles given out since the program last stopped, along with the
+	// variable objects created to expand variables.
+	frames  map[int]dapFrame
+	varRefs map[int]dapVarRef
+	varObjs []string
+	lastRef int
+	// Whether the client has sent a valid token, or needs none.
+	authed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var errDapNotStarted = errors.New("no program, send launch or attach first")
+
+var errDapNoToken = errors.New(`no token given, send it as "authToken" in ` +
+	`the arguments of initialize, launch or attach`)
+
+func newDapSsn(in io.Reader, out io.Writer) *dapSsn {
+	d := &dapSsn{
+		in:     bufio.NewReader(in),
+		out:    out,
+		outMtx: &sync.Mutex{},
+		gdbErr: make(chan error),
+		bkpts:  make(map[string][]string),
+		authed: !authEnabled(),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.resetRefs()
+	return d
+}
+
+type dapHandler func(d *dapSsn, ctx context.Context, args json.RawMessage) (interface{}, error)
+
+var dapHandlers = map[string]dapHandler{
+	"initialize":             (*dapSsn).initialize,
+	"launch":                 (*dapSsn).launchReq,
+	"attach":                 (*dapSsn).attach,
+	"setBreakpoints":         (*dapSsn).setBreakpoints,
+	"setFunctionBreakpoints": (*dapSsn).setFunctionBreakpoints,
+	"configurationDone":      (*dapSsn).configurationDone,
+	"threads":                (*dapSsn).threads,
+	"stackTrace":             (*dapSsn).stackTrace,
+	"scopes":                 (*dapSsn).scopes,
+	"variables":              (*dapSsn).variables,
+	"continue":               (*dapSsn).continueReq,
+	"next":                   (*dapSsn).next,
+	"stepIn":                 (*dapSsn).stepIn,
+	"stepOut":                (*dapSsn).stepOut,
+	"pause":                  (*dapSsn).pause,
+}
+
+// Handles requests until the client disconnects or goes away.
+func (d *dapSsn) run() error {
+
+	defer d.close(false)
+	for {
+		bts, err := readDapMsg(d.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		req := &dapRequest{}
+		if err = json.Unmarshal(bts, req); err != nil {
+			return fmt.Errorf("malformed dap message: %v", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		if req.Command == "disconnect" {
+			var args struct {
+				TerminateDebuggee bool `json:"terminateDebuggee"`
+			}
+			json.Unmarshal(req.Arguments, &args)
+			d.close(args.TerminateDebuggee)
+			d.respond(req, nil, nil)
+			return nil
+		}
+
+		handler, ok := dapHandlers[req.Command]
+		if !ok {
+			d.respond(req, nil, fmt.Errorf("unsupported request: %s", req.Command))
+			continue
+		}
+		if err = d.authenticate(req); err != nil {
+			d.respond(req, nil, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(d.ctx, cmdTimeout)
+		body, err := handler(d, ctx, req.Arguments)
+		cancel()
+		d.respond(req, body, err)
+		if err == nil && (req.Command == "launch" || req.Command == "attach") {
+			// the GDB is up, breakpoints can be set now
+			d.event("initialized", nil)
+		}
+	}
+}
+
+// Checks the "authToken" a client sends with initialize, launch or
+// attach, DAP has no other place for it. Other requests are refused
+// until one of those brought a valid token.
+func (d *dapSsn) authenticate(req *dapRequest) error {
+
+	if d.authed {
+		return nil
+	}
+	var args struct {
+		AuthToken string `json:"authToken"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+	if len(args.AuthToken) == 0 {
+		if req.Command == "initialize" {
+			return nil
+		}
+		return errDapNoToken
+	}
+	name, err := checkToken(args.AuthToken)
+	if err != nil {
+		log.Println("rejected dap client: ", err)
+		return err
+	}
+	log.Println("dap client: ", name)
+	d.authed = true
+	return nil
+}
+
+// Reads the body of the next message, which is preceded by a
+// Content-Length header and a blank line.
+func readDapMsg(r *bufio.Reader) ([]byte, error) {
+
+	hdr, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || len(hdr) == 0 {
+			return nil, err
+		}
+		return nil, fmt.Errorf("malformed dap header: %v", err)
+	}
+	n, err := strconv.Atoi(hdr.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("malformed dap Content-Length: %q", hdr.Get("Content-Length"))
+	}
+	bts := make([]byte, n)
+	_, err = io.ReadFull(r, bts)
+	return bts, err
+}
+
+func (d *dapSsn) write(msg interface{}, seq *int) {
+
+	d.outMtx.Lock()
+	defer d.outMtx.Unlock()
+	d.seq++
+	*seq = d.seq
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("Err: Unable to encode dap message: ", err)
+		return
+	}
+	if _, err = fmt.Fprintf(d.out, "Content-Length: %d\r\n\r\n%s", len(bts), bts); err != nil {
+		log.Println("Err: Unable to send to dap client: ", err)
+	}
+}
+
+func (d *dapSsn) respond(req *dapRequest, body interface{}, err error) {
+	resp := &dapResponse{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	d.write(resp, &resp.Seq)
+}
+
+func (d *dapSsn) event(name string, body interface{}) {
+	ev := &dapEvent{Type: "event", Event: name, Body: body}
+	d.write(ev, &ev.Seq)
+}
+
+func (d *dapSsn) output(category, s string) {
+	d.event("output", map[string]string{"category": category, "output": s})
+}
+
+// Sends the output of the program and the GDB and its stops as events
+// until the session ends.
+func (d *dapSsn) forward(sub *gdb.Subscription) {
+
+	inferiorOut := d.gdbSsn.InferiorOutput()
+	events := sub.C
+	for {
+		select {
+		case s := <-inferiorOut:
+			d.output("stdout", s)
+
+		case err := <-d.gdbErr:
+			d.output("stderr", err.Error()+"\n")
+
+		case r, ok := <-events:
+			if !ok {
+				events = nil
+				break
+			}
+			d.onRecord(r)
+
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *dapSsn) onRecord(r *gdb.Record) {
+
+	if r.Class == "gdb-exited" {
+		d.event("terminated", nil)
+		return
+	}
+	ev, err := gdb.DecodeStoppedEvent(r)
+	if err != nil {
+		d.output("stderr", err.Error()+"\n")
+		return
+	}
+	if gdb.IsExitReason(ev.Reason) {
+		d.event("exited", map[string]int{"exitCode": ev.ExitCode})
+		d.event("terminated", nil)
+		return
+	}
+	body := map[string]interface{}{
+		"reason":            dapStopReason(ev),
+		"allThreadsStopped": true,
+	}
+	if id, err := strconv.Atoi(ev.ThreadId); err == nil {
+		body["threadId"] = id
+	}
+	if ev.Reason == "signal-received" {
+		body["description"] = ev.SignalMeaning
+	}
+	d.event("stopped", body)
+}
+
+// Maps the reason of a *stopped record to a DAP stop reason.
+func dapStopReason(ev *gdb.StoppedEvent) string {
+	switch ev.Reason {
+	case "breakpoint-hit":
+		return "breakpoint"
+	case "watchpoint-trigger", "read-watchpoint-trigger", "access-watchpoint-trigger":
+		return "data breakpoint"
+	case "end-stepping-range", "function-finished", "location-reached":
+		return "step"
+	case "signal-received":
+		if ev.SignalName == "SIGINT" {
+			return "pause"
+		}
+		return "exception"
+	}
+	return "pause"
+}
+
+// Starts the GDB, the exe is empty when attaching.
+func (d *dapSsn) start(exe string, args ...string) error {
+
+	if d.gdbSsn != nil {
+		return gdb.ErrIsStarted
+	}
+	dir, err := getSsnSpace()
+	if err != nil {
+		return err
+	}
+	g := gdb.NewSsn(dir+string(os.PathSeparator)+"programOut.log", d.gdbErr)
+	sub := g.Subscribe([]byte{gdb.NATURE_EXEC_OUT, gdb.NATURE_NOTIFY}, "stopped", "gdb-exited")
+	if err = g.StartContext(d.ctx, exe, args...); err != nil {
+		g.Close()
+		return err
+	}
+	d.gdbSsn = g
+	go d.forward(sub)
+	return nil
+}
+
+// Ends the GDB. An attached process is detached from rather than killed
+// along with the GDB unless terminate is set.
+func (d *dapSsn) close(terminate bool) {
+
+	g := d.gdbSsn
+	if g != nil && g.IsStarted() && !g.IsKilled() && !terminate && g.Target().Mode == gdb.MODE_ATTACH {
+		ctx, cancel := context.WithTimeout(context.Background(), detachTimeout)
+		if err := g.Detach(ctx); err != nil {
+			log.Println("Err: Unable to detach: ", err)
+		}
+		cancel()
+	}
+	if g != nil {
+		g.Close()
+	}
+	d.cancel()
+}
+
+// Forgets the frames and variables handed out, they are only good while
+// the program stays stopped.
+func (d *dapSsn) resetRefs() {
+
+	if d.gdbSsn != nil {
+		ctx, cancel := context.WithTimeout(d.ctx, cmdTimeout)
+		for _, name := range d.varObjs {
+			d.gdbSsn.VarObjs().Delete(ctx, name)
+		}
+		cancel()
+	}
+	d.frames = make(map[int]dapFrame)
+	d.varRefs = make(map[int]dapVarRef)
+	d.varObjs = nil
+}
+
+func (d *dapSsn) newRef() int {
+	d.lastRef++
+	return d.lastRef
+}
+
+func (d *dapSsn) initialize(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	return map[string]bool{
+		"supportsConfigurationDoneRequest":  true,
+		"supportsFunctionBreakpoints":       true,
+		"supportsConditionalBreakpoints":    true,
+		"supportsHitConditionalBreakpoints": true,
+	}, nil
+}
+
+// Starts the GDB on "program" with "args", "env" and "cwd". The program
+// runs on configurationDone.
+func (d *dapSsn) launchReq(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		Program string `json:"program"`
+		gdb.Launch
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	if len(a.Program) == 0 {
+		return nil, errors.New("no program given")
+	}
+	if err := d.start(a.Program, a.Args...); err != nil {
+		return nil, err
+	}
+	d.launch = &a.Launch
+	return nil, d.gdbSsn.SetLaunch(ctx, d.launch)
+}
+
+// Attaches to the process with "pid", the program goes on on
+// configurationDone.
+func (d *dapSsn) attach(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		Pid int `json:"pid"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	if a.Pid <= 0 {
+		return nil, errors.New("no pid given")
+	}
+	if err := d.start(""); err != nil {
+		return nil, err
+	}
+	return nil, d.gdbSsn.Attach(ctx, a.Pid)
+}
+
+func (d *dapSsn) configurationDone(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	if d.gdbSsn == nil {
+		return nil, errDapNotStarted
+	}
+	if d.launch != nil {
+		return nil, d.gdbSsn.RunContext(ctx, nil)
+	}
+	return nil, d.resume(ctx, "-exec-continue")
+}
+
+type dapSourceBkpt struct {
+	Line         int    `json:"line"`
+	Condition    string `json:"condition"`
+	HitCondition string `json:"hitCondition"`
+}
+
+// Replaces the breakpoints of a source file.
+func (d *dapSsn) setBreakpoints(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		Source      dapSource       `json:"source"`
+		Breakpoints []dapSourceBkpt `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	if len(a.Source.Path) == 0 {
+		return nil, errors.New("no source path given")
+	}
+	locs := make([]string, len(a.Breakpoints))
+	for i, b := range a.Breakpoints {
+		locs[i] = fmt.Sprintf("%s:%d", a.Source.Path, b.Line)
+	}
+	return d.replaceBkpts(ctx, a.Source.Path, locs, a.Breakpoints)
+}
+
+// Replaces the breakpoints on functions.
+func (d *dapSsn) setFunctionBreakpoints(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		Breakpoints []struct {
+			Name string `json:"name"`
+			dapSourceBkpt
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	locs := make([]string, len(a.Breakpoints))
+	opts := make([]dapSourceBkpt, len(a.Breakpoints))
+	for i, b := range a.Breakpoints {
+		locs[i], opts[i] = b.Name, b.dapSourceBkpt
+	}
+	return d.replaceBkpts(ctx, "", locs, opts)
+}
+
+// Deletes the breakpoints set before under key and inserts one at each
+// location. A breakpoint that can't be inserted is reported unverified.
+func (d *dapSsn) replaceBkpts(ctx context.Context, key string, locs []string,
+	opts []dapSourceBkpt) (interface{}, error) {
+
+	if d.gdbSsn == nil {
+		return nil, errDapNotStarted
+	}
+	bps := d.gdbSsn.Breakpoints()
+	if old := d.bkpts[key]; len(old) > 0 {
+		if err := bps.Delete(ctx, old...); err != nil {
+			return nil, err
+		}
+	}
+	d.bkpts[key] = nil
+
+	result := make([]*dapBreakpoint, len(locs))
+	for i, loc := range locs {
+		o := &gdb.BreakpointOpts{Condition: opts[i].Condition}
+		if len(opts[i].HitCondition) > 0 {
+			n, err := strconv.Atoi(strings.TrimSpace(opts[i].HitCondition))
+			if err != nil || n < 1 {
+				result[i] = &dapBreakpoint{Message: "hit condition must be a positive count"}
+				continue
+			}
+			o.Ignore = n - 1
+		}
+		bp, err := bps.Insert(ctx, loc, o)
+		if err != nil {
+			result[i] = &dapBreakpoint{Message: err.Error()}
+			continue
+		}
+		d.bkpts[key] = append(d.bkpts[key], bp.Number)
+		id, _ := strconv.Atoi(bp.Number)
+		result[i] = &dapBreakpoint{Id: id, Verified: len(bp.Pending) == 0, Line: bp.Line}
+	}
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+func (d *dapSsn) threads(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	list := make([]*dapThread, 0)
+	if d.gdbSsn == nil || d.gdbSsn.Target().State != gdb.STATE_STOPPED {
+		return map[string]interface{}{"threads": list}, nil
+	}
+	i, resp, err := d.gdbSsn.GetResponseContext(ctx, "-thread-info")
+	if err != nil {
+		return nil, err
+	}
+	threads, _, err := gdb.DecodeThreadInfo(resp.Records[i].Data)
+	if err != nil {
+		return nil, err
+	}
+	for _, th := range threads {
+		id, err := strconv.Atoi(th.Id)
+		if err != nil {
+			continue
+		}
+		name := th.Name
+		if len(name) == 0 {
+			name = th.TargetId
+		}
+		list = append(list, &dapThread{id, name})
+	}
+	return map[string]interface{}{"threads": list}, nil
+}
+
+func (d *dapSsn) stackTrace(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		ThreadId   int `json:"threadId"`
+		StartFrame int `json:"startFrame"`
+		Levels     int `json:"levels"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	if d.gdbSsn == nil {
+		return nil, errDapNotStarted
+	}
+	threadId := strconv.Itoa(a.ThreadId)
+	cmd := "-stack-list-frames --thread " + threadId
+	if a.Levels > 0 {
+		cmd += fmt.Sprintf(" %d %d", a.StartFrame, a.StartFrame+a.Levels-1)
+	}
+	i, resp, err := d.gdbSsn.GetResponseContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	stack, err := gdb.DecodeStack(resp.Records[i].Data)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]*dapStackFrame, 0, len(stack))
+	for _, f := range stack {
+		id := d.newRef()
+		d.frames[id] = dapFrame{threadId, f.Level}
+		sf := &dapStackFrame{Id: id, Name: f.Func, Line: f.Line}
+		if len(f.Fullname) > 0 {
+			sf.Source = &dapSource{filepath.Base(f.Fullname), f.Fullname}
+		}
+		frames = append(frames, sf)
+	}
+	return map[string]interface{}{"stackFrames": frames}, nil
+}
+
+func (d *dapSsn) scopes(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		FrameId int `json:"frameId"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	f, ok := d.frames[a.FrameId]
+	if !ok {
+		return nil, fmt.Errorf("unknown frame: %d", a.FrameId)
+	}
+	ref := d.newRef()
+	d.varRefs[ref] = dapVarRef{frame: f}
+	return map[string]interface{}{"scopes": []*dapScope{{"Locals", ref, false}}}, nil
+}
+
+// Lists the arguments and locals of a frame or the children of a
+// variable. Values that aren't simple are expanded with variable
+// objects.
+func (d *dapSsn) variables(ctx context.Context, args json.RawMessage) (interface{}, error) {
+
+	var a struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return nil, err
+	}
+	ref, ok := d.varRefs[a.VariablesReference]
+	if !ok {
+		return nil, fmt.Errorf("unknown variables reference: %d", a.VariablesReference)
+	}
+	objs := d.gdbSsn.VarObjs()
+	list := make([]*dapVariable, 0)
+
+	if len(ref.varObj) > 0 {
+		children, err := objs.ListChildren(ctx, ref.varObj)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			list = append(list, d.varObjVariable(c.Exp, c))
+		}
+		return map[string]interface{}{"variables": list}, nil
+	}
+
+	vars, err := d.gdbSsn.GetFrameVarsContext(ctx, ref.frame.threadId, ref.frame.level)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		if len(v.Value) > 0 {
+			list = append(list, &dapVariable{Name: v.Name, Value: v.Value, Type: v.Type})
+			continue
+		}
+		obj, err := objs.Create(ctx, v.Name, ref.frame.threadId, ref.frame.level)
+		if err != nil {
+			list = append(list, &dapVariable{Name: v.Name, Value: err.Error(), Type: v.Type})
+			continue
+		}
+		d.varObjs = append(d.varObjs, obj.Name)
+		list = append(list, d.varObjVariable(v.Name, obj))
+	}
+	return map[string]interface{}{"variables": list}, nil
+}
+
+// Returns the variable for a variable object, expandable when it has
+// children.
+func (d *dapSsn) varObjVariable(name string, obj *gdb.VarObj) *dapVariable {
+	v := &dapVariable{Name: name, Value: obj.Value, Type: obj.Type}
+	if obj.NumChild > 0 || obj.Dynamic {
+		v.VariablesReference = d.newRef()
+		d.varRefs[v.VariablesReference] = dapVarRef{varObj: obj.Name}
+	}
+	return v
+}
+
+// Issues an exec command and returns once the program is running, the
+// stop is sent as an event.
+func (d *dapSsn) resume(ctx context.Context, cmd string) error {
+
+	if d.gdbSsn == nil {
+		return errDapNotStarted
+	}
+	if d.gdbSsn.Target().Mode == gdb.MODE_CORE {
+		return gdb.ErrCoreTarget
+	}
+	d.resetRefs()
+	_, _, err := d.gdbSsn.GetResponseContext(ctx, cmd)
+	return err
+}
+
+// Returns the exec command for the thread in args.
+func dapThreadCmd(cmd string, args json.RawMessage) (string, error) {
+	var a struct {
+		ThreadId int `json:"threadId"`
+	}
+	if err := json.Unmarshal(args, &a); err != nil {
+		return "", err
+	}
+	if a.ThreadId > 0 {
+		cmd += fmt.Sprintf(" --thread %d", a.ThreadId)
+	}
+	return cmd, nil
+}
+
+func (d *dapSsn) continueReq(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	if err := d.resume(ctx, "-exec-continue"); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"allThreadsContinued": true}, nil
+}
+
+func (d *dapSsn) step(ctx context.Context, cmd string, args json.RawMessage) (interface{}, error) {
+	cmd, err := dapThreadCmd(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return nil, d.resume(ctx, cmd)
+}
+
+func (d *dapSsn) next(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	return d.step(ctx, "-exec-next", args)
+}
+
+func (d *dapSsn) stepIn(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	return d.step(ctx, "-exec-step", args)
+}
+
+func (d *dapSsn) stepOut(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	return d.step(ctx, "-exec-finish", args)
+}
+
+func (d *dapSsn) pause(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	if d.gdbSsn == nil {
+		return nil, errDapNotStarted
+	}
+	_, _, err := d.gdbSsn.GetResponseContext(ctx, "-exec-interrupt")
+	return nil, err
+}
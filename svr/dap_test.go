@@ -0,0 +1,40 @@
+package svr
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadDapMsg(t *testing.T) {
+
+	r := bufio.NewReader(strings.NewReader(
+		"Content-Length: 2\r\n\r\n{}" +
+			"Content-Type: application/json\r\nContent-Length: 13\r\n\r\n{\"seq\":1234}\n" +
+			"Content-Length: 0\r\n\r\n"))
+	for _, want := range []string{"{}", "{\"seq\":1234}\n", ""} {
+		bts, err := readDapMsg(r)
+		if err != nil {
+			t.Fatalf("readDapMsg: %v", err)
+		}
+		if string(bts) != want {
+			t.Errorf("got %q, want %q", bts, want)
+		}
+	}
+	if _, err := readDapMsg(r); err != io.EOF {
+		t.Errorf("at the end: got %v, want io.EOF", err)
+	}
+
+	for _, in := range []string{
+		"Content-Length: x\r\n\r\n{}",
+		"Content-Length: -1\r\n\r\n",
+		"Content-Type: application/json\r\n\r\n{}",
+		"not a header\r\n\r\n",
+		"Content-Length: 10\r\n\r\n{}",
+	} {
+		if _, err := readDapMsg(bufio.NewReader(strings.NewReader(in))); err == nil || err == io.EOF {
+			t.Errorf("%q: got %v, want an error", in, err)
+		}
+	}
+}
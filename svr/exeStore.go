@@ -0,0 +1,184 @@
+package svr
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Debug settings remembered per executable, stored as JSON under the
+// session dir so they outlive the session that made them.
+type exeSettings struct {
+	Exe string `json:"exe"`
+	gdb.Launch
+	Breakpoints []*savedBkpt `json:"breakpoints"`
+	Watches     []string     `json:"watches"`
+	file        string
+}
+
+type savedBkpt struct {
+	Location string              `json:"location"`
+	Opts     *gdb.BreakpointOpts `json:"opts,omitempty"`
+}
+
+// Returns the stored settings for exe or empty settings when there
+// are none yet.
+func loadExeSettings(exe string) (*exeSettings, error) {
+
+	abs, err := filepath.Abs(exe)
+	if err != nil {
+		return nil, err
+	}
+	sep := string(os.PathSeparator)
+	s := &exeSettings{
+		Exe:  abs,
+		file: fmt.Sprintf("%s%sexe%s%x.json", ssnBaseDir, sep, sep, sha1.Sum([]byte(abs))),
+	}
+	bts, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bts, s); err != nil {
+		return nil, fmt.Errorf("corrupt settings %s: %v", s.file, err)
+	}
+	return s, nil
+}
+
+func (s *exeSettings) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.file), os.ModePerm); err != nil {
+		return err
+	}
+	bts, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.file, bts, 0644)
+}
+
+// Replaces the saved breakpoints with the current table. Temporary
+// breakpoints, watchpoints and catchpoints are not kept.
+func (s *exeSettings) setBreakpoints(bps []*gdb.Breakpoint) {
+
+	s.Breakpoints = make([]*savedBkpt, 0, len(bps))
+	for _, bp := range bps {
+		loc, opts := bp.Location(), bp.Opts()
+		if len(loc) == 0 || opts == nil {
+			continue
+		}
+		s.Breakpoints = append(s.Breakpoints, &savedBkpt{loc, opts})
+	}
+}
+
+// Replaces the saved launch settings with those given in l. Args and
+// the working directory are replaced when set, env overrides are merged.
+// Returns true when anything changed.
+func (s *exeSettings) override(l *gdb.Launch) bool {
+
+	changed := false
+	if l.Args != nil {
+		s.Args = l.Args
+		changed = true
+	}
+	for name, value := range l.Env {
+		if s.Env == nil {
+			s.Env = make(map[string]string)
+		}
+		s.Env[name] = value
+		changed = true
+	}
+	if len(l.Dir) > 0 {
+		s.Dir = l.Dir
+		changed = true
+	}
+	return changed
+}
+
+// Inserts the saved breakpoints and sets the saved program arguments,
+// environment and working directory in a freshly started GDB. Keeps
+// going past failures, which are returned together.
+func (s *exeSettings) apply(ctx context.Context, gdbSsn *gdb.Ssn) error {
+
+	var errs []string
+	if err := gdbSsn.SetLaunch(ctx, &s.Launch); err != nil {
+		errs = append(errs, err.Error())
+	}
+	bps := gdbSsn.Breakpoints()
+	for _, sb := range s.Breakpoints {
+		if _, err := bps.Insert(ctx, sb.Location, sb.Opts); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to restore settings for %s: %s", s.Exe, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Loads the settings for exe into the session and applies them to the
+// just started GDB. Launch settings given on start override the saved
+// ones, saved watches are added to the session's.
+func (t *gdbTarget) restoreExeSettings(exe string, l *gdb.Launch) {
+
+	settings, err := loadExeSettings(exe)
+	if err != nil {
+		log.Println("Err: Unable to load exe settings: ", err)
+		t.cmdMsgBody.sendErr(t.ssn.ws, err)
+		return
+	}
+	t.exe = settings
+	for _, e := range settings.Watches {
+		t.watches.add(e)
+	}
+	if settings.override(l) {
+		if err = settings.save(); err != nil {
+			log.Println("Err: Unable to save exe settings: ", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+	defer cancel()
+	if err = settings.apply(ctx, t.gdbSsn); err != nil {
+		t.cmdMsgBody.sendErr(t.ssn.ws, err)
+	}
+	t.cmdMsgBody.send(t.ssn.ws, "settings", settings)
+}
+
+// Stores the current breakpoints and watches with the settings of the
+// loaded exe.
+func (t *gdbTarget) saveExeSettings() {
+	if t.exe == nil {
+		return
+	}
+	t.exe.setBreakpoints(t.gdbSsn.Breakpoints().List())
+	t.exe.Watches = append([]string(nil), t.watches.exprs...)
+	if err := t.exe.save(); err != nil {
+		log.Println("Err: Unable to save exe settings: ", err)
+	}
+}
+
+// Sets the launch settings given by the client for the next run and
+// remembers them with the settings of the loaded exe.
+func (t *gdbTarget) setLaunch(l *gdb.Launch) error {
+
+	ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+	defer cancel()
+	if err := t.gdbSsn.SetLaunch(ctx, l); err != nil {
+		return err
+	}
+	if t.exe != nil && t.exe.override(l) {
+		if err := t.exe.save(); err != nil {
+			log.Println("Err: Unable to save exe settings: ", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package svr
+
+import (
+	"context"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"strings"
+)
+
+type execFunc func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error)
+
+// The execution control admin commands. Each waits for the program to
+// stop and replies with the stop event keyed by the command name.
+var execCmds = map[string]execFunc{
+	"-exec-continue": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Continue(ctx, false)
+	},
+	"-exec-next": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Next(ctx, false)
+	},
+	"-exec-step": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Step(ctx, false)
+	},
+	"-exec-finish": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Finish(ctx, false)
+	},
+	"-exec-until": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Until(ctx, strings.Join(args, " "))
+	},
+	"-exec-interrupt": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Interrupt(ctx)
+	},
+	"-exec-reverse-continue": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Continue(ctx, true)
+	},
+	"-exec-reverse-next": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Next(ctx, true)
+	},
+	"-exec-reverse-step": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Step(ctx, true)
+	},
+	"-exec-reverse-finish": func(ctx context.Context, g *gdb.Ssn, args []string) (*gdb.StoppedEvent, error) {
+		return g.Finish(ctx, true)
+	},
+}
+
+// Runs an exec command in the background, the program may run for a
+// long time before it stops and the session has to stay responsive,
+// e.g. to handle an -exec-interrupt.
+func handleExecCmd(t *gdbTarget, adminCmd string, fn execFunc, args []string) {
+
+	g := t.gdbSsn
+	req := t.ssn.ws.req
+	go func() {
+		ev, err := fn(t.ssn.ctx, g, args)
+		t.ssn.laterReply(req, func() {
+			if err != nil {
+				t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+				return
+			}
+			// SSE clients get the stop too, as they do a raw *stopped
+			t.cmdMsgBody.broadcast(t.ssn.ws, adminCmd, ev)
+		})
+	}()
+}
@@ -6,7 +6,7 @@ import (
 	"time"
 )
 
-func getSsnSpace() (ssnDir, ssnLogFile string, err error) {
+func getSsnSpace() (ssnDir string, err error) {
 
 	sep := string(os.PathSeparator)
 	t := time.Now()
@@ -37,11 +37,5 @@ func getSsnSpace() (ssnDir, ssnLogFile string, err error) {
 	}
 	ssnDir = nm
 
-	ssnLogFile = ssnDir + sep + "programOut.log"
-	_, err = os.Create(ssnLogFile)
-	if err != nil {
-		return
-	}
-
-	return ssnDir, ssnLogFile, nil
+	return ssnDir, nil
 }
@@ -0,0 +1,284 @@
+package gdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Returned for breakpoint and thread numbers that aren't numbers, they
+// are put in MI commands as they are.
+var ErrBadNumber = errors.New("gdb: not a valid number")
+
+// Options for -break-insert.
+type BreakpointOpts struct {
+	Temporary bool   `json:"temporary,omitempty"`
+	Hardware  bool   `json:"hardware,omitempty"`
+	Disabled  bool   `json:"disabled,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	Ignore    int    `json:"ignore,omitempty"`
+	Thread    string `json:"thread,omitempty"`
+}
+
+// Server side copy of the GDB breakpoint table. Kept current by the
+// breakpoint commands issued through it and by the =breakpoint-created,
+// =breakpoint-modified and =breakpoint-deleted notifications caused by
+// commands issued elsewhere, e.g. a raw 'break' from the client.
+type Breakpoints struct {
+	ssn   *Ssn
+	mtx   *sync.Mutex
+	table map[string]*Breakpoint
+}
+
+func newBreakpoints(ssn *Ssn) *Breakpoints {
+	b := &Breakpoints{ssn, &sync.Mutex{}, make(map[string]*Breakpoint)}
+	sub := ssn.Subscribe([]byte{NATURE_NOTIFY}, "breakpoint-created", "breakpoint-modified", "breakpoint-deleted")
+	go b.track(sub)
+	return b
+}
+
+func (b *Breakpoints) track(sub *Subscription) {
+	for r := range sub.C {
+		if r.Class == "breakpoint-deleted" {
+			b.mtx.Lock()
+			delete(b.table, str(r.Data, "id"))
+			b.mtx.Unlock()
+			continue
+		}
+		if bp, err := DecodeBreakpoint(r.Data["bkpt"]); err == nil {
+			b.set(bp)
+		}
+	}
+}
+
+func (b *Breakpoints) set(bps ...*Breakpoint) {
+	b.mtx.Lock()
+	for _, bp := range bps {
+		b.table[bp.Number] = bp
+	}
+	b.mtx.Unlock()
+}
+
+// Returns a copy of the table ordered by breakpoint number.
+func (b *Breakpoints) List() []*Breakpoint {
+	b.mtx.Lock()
+	list := make([]*Breakpoint, 0, len(b.table))
+	for _, bp := range b.table {
+		cp := *bp
+		list = append(list, &cp)
+	}
+	b.mtx.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return bpNumLess(list[i].Number, list[j].Number)
+	})
+	return list
+}
+
+func (b *Breakpoints) Get(number string) (*Breakpoint, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	bp, ok := b.table[number]
+	if !ok {
+		return nil, false
+	}
+	cp := *bp
+	return &cp, true
+}
+
+// Inserts a breakpoint at location, e.g. "main.main" or "dev_0.go:33".
+func (b *Breakpoints) Insert(ctx context.Context, location string, opts *BreakpointOpts) (*Breakpoint, error) {
+
+	cmd := "-break-insert -f"
+	if opts != nil {
+		if opts.Temporary {
+			cmd += " -t"
+		}
+		if opts.Hardware {
+			cmd += " -h"
+		}
+		if opts.Disabled {
+			cmd += " -d"
+		}
+		if len(opts.Condition) > 0 {
+			cmd += " -c " + quote(opts.Condition)
+		}
+		if opts.Ignore > 0 {
+			cmd += fmt.Sprintf(" -i %d", opts.Ignore)
+		}
+		if len(opts.Thread) > 0 {
+			if err := checkThreadId(opts.Thread); err != nil {
+				return nil, err
+			}
+			cmd += " -p " + opts.Thread
+		}
+	}
+	cmd += " " + quote(location)
+
+	i, resp, err := b.ssn.GetResponseContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := DecodeBreakpoint(resp.Records[i].Data["bkpt"])
+	if err != nil {
+		return nil, err
+	}
+	b.set(bp)
+	return bp, nil
+}
+
+func (b *Breakpoints) Delete(ctx context.Context, numbers ...string) error {
+	if err := b.modify(ctx, "-break-delete", numbers); err != nil {
+		return err
+	}
+	b.mtx.Lock()
+	for _, n := range numbers {
+		delete(b.table, n)
+	}
+	b.mtx.Unlock()
+	return nil
+}
+
+func (b *Breakpoints) Enable(ctx context.Context, numbers ...string) error {
+	return b.modify(ctx, "-break-enable", numbers)
+}
+
+func (b *Breakpoints) Disable(ctx context.Context, numbers ...string) error {
+	return b.modify(ctx, "-break-disable", numbers)
+}
+
+// Sets the condition of a breakpoint, an empty cond removes it.
+func (b *Breakpoints) Condition(ctx context.Context, number, cond string) error {
+	if len(cond) == 0 {
+		return b.modify(ctx, "-break-condition", []string{number})
+	}
+	return b.modify(ctx, "-break-condition", []string{number}, quote(cond))
+}
+
+// Makes the breakpoint ignore the next count hits.
+func (b *Breakpoints) After(ctx context.Context, number string, count int) error {
+	return b.modify(ctx, "-break-after", []string{number}, strconv.Itoa(count))
+}
+
+// Replaces the table with the output of -break-list.
+func (b *Breakpoints) Refresh(ctx context.Context) error {
+
+	i, resp, err := b.ssn.GetResponseContext(ctx, "-break-list")
+	if err != nil {
+		return err
+	}
+	tbl, err := tupleOf("BreakpointTable", resp.Records[i].Data["BreakpointTable"])
+	if err != nil {
+		return err
+	}
+	body, err := listOf("body", tbl["body"])
+	if err != nil {
+		return err
+	}
+	table := make(map[string]*Breakpoint, len(body))
+	for _, v := range body {
+		bp, err := DecodeBreakpoint(v)
+		if err != nil {
+			return err
+		}
+		table[bp.Number] = bp
+	}
+	b.mtx.Lock()
+	b.table = table
+	b.mtx.Unlock()
+	return nil
+}
+
+// GDB does not send notifications for changes made by MI commands so
+// the table is refreshed after each one. The breakpoint numbers are
+// followed by args.
+func (b *Breakpoints) modify(ctx context.Context, cmd string, numbers []string, args ...string) error {
+	if len(numbers) == 0 {
+		return fmt.Errorf("gdb: %s: no breakpoint given", cmd)
+	}
+	for _, n := range numbers {
+		if err := checkBpNumber(n); err != nil {
+			return err
+		}
+	}
+	args = append(append([]string{}, numbers...), args...)
+	if _, _, err := b.ssn.GetResponseContext(ctx, cmd+" "+strings.Join(args, " ")); err != nil {
+		return err
+	}
+	return b.Refresh(ctx)
+}
+
+// Empties the table when the GDB is restarted.
+func (b *Breakpoints) reset() {
+	b.mtx.Lock()
+	b.table = make(map[string]*Breakpoint)
+	b.mtx.Unlock()
+}
+
+// Returns where the breakpoint was asked for, e.g. "main.main", or where
+// it is when that isn't known.
+func (bp *Breakpoint) Location() string {
+	if len(bp.OriginalLocation) > 0 {
+		return bp.OriginalLocation
+	}
+	if len(bp.File) > 0 {
+		return fmt.Sprintf("%s:%d", bp.File, bp.Line)
+	}
+	return bp.Func
+}
+
+// Returns the options to insert the breakpoint again with, or nil for
+// temporary breakpoints, watchpoints, catchpoints and the locations of
+// breakpoints with several, e.g. "2.1".
+func (bp *Breakpoint) Opts() *BreakpointOpts {
+	if bp.Disp == "del" || !strings.HasSuffix(bp.Type, "breakpoint") || strings.Contains(bp.Number, ".") {
+		return nil
+	}
+	return &BreakpointOpts{
+		Hardware:  strings.HasPrefix(bp.Type, "hw"),
+		Disabled:  !bp.Enabled,
+		Condition: bp.Cond,
+		Ignore:    bp.Ignore,
+		Thread:    bp.Thread,
+	}
+}
+
+// Checks n is a breakpoint number, e.g. "2", or the number of one of
+// its locations, e.g. "2.1".
+func checkBpNumber(n string) error {
+	parts := strings.Split(n, ".")
+	if len(parts) > 2 {
+		return fmt.Errorf("%w: breakpoint %q", ErrBadNumber, n)
+	}
+	for _, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 32); err != nil {
+			return fmt.Errorf("%w: breakpoint %q", ErrBadNumber, n)
+		}
+	}
+	return nil
+}
+
+// Checks id is a GDB thread number.
+func checkThreadId(id string) error {
+	if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+		return fmt.Errorf("%w: thread %q", ErrBadNumber, id)
+	}
+	return nil
+}
+
+// Orders breakpoint numbers like "2" < "10" < "10.1".
+func bpNumLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		if an != bn {
+			return an < bn
+		}
+	}
+	return len(as) < len(bs)
+}
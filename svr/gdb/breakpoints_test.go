@@ -0,0 +1,105 @@
+package gdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckBpNumber(t *testing.T) {
+
+	for _, n := range []string{"1", "12", "2.1"} {
+		if err := checkBpNumber(n); err != nil {
+			t.Errorf("checkBpNumber(%q): %v", n, err)
+		}
+	}
+	for _, n := range []string{"", "x", "-1", "+1", "1.", "1.2.3", "1\n-gdb-exit", "1 2"} {
+		if err := checkBpNumber(n); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("checkBpNumber(%q): got %v, want ErrBadNumber", n, err)
+		}
+	}
+	for _, id := range []string{"", "1.1", "1\n5^done", "all"} {
+		if err := checkThreadId(id); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("checkThreadId(%q): got %v, want ErrBadNumber", id, err)
+		}
+	}
+}
+
+func TestBpNumLess(t *testing.T) {
+
+	sorted := []string{"1", "2", "2.1", "2.2", "10", "10.1"}
+	for i := 0; i+1 < len(sorted); i++ {
+		if !bpNumLess(sorted[i], sorted[i+1]) || bpNumLess(sorted[i+1], sorted[i]) {
+			t.Errorf("%s and %s are out of order", sorted[i], sorted[i+1])
+		}
+	}
+}
+
+func TestBreakpointTable(t *testing.T) {
+
+	ssn := startFakeGdb(t)
+	ctx := testCtx(t)
+	bps := ssn.Breakpoints()
+
+	for _, loc := range []string{"main.go:1", "main.go:2", "main.go:3"} {
+		if _, err := bps.Insert(ctx, loc, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bps.Delete(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	list := bps.List()
+	if len(list) != 2 || list[0].Number != "1" || list[1].Number != "3" {
+		t.Fatalf("after delete: %v", list)
+	}
+	if bp, ok := bps.Get("3"); !ok || bp.Line != 3 || bp.Location() != "main.go:3" {
+		t.Errorf("Get(3) = %+v, %v", bp, ok)
+	}
+
+	// List and Get return copies
+	list[0].Line = 99
+	if bp, _ := bps.Get("1"); bp.Line != 1 {
+		t.Error("List handed out the table's breakpoint")
+	}
+
+	// a breakpoint set by a raw command is tracked from its notification
+	r := parseRecord(t, `=breakpoint-created,bkpt={number="7",type="breakpoint",disp="keep",enabled="y",addr="0x1",file="x.go",line="7",times="0"}`)
+	ssn.events.publish([]*Record{r})
+	waitBp(t, bps, "7", true)
+	ssn.events.publish([]*Record{parseRecord(t, `=breakpoint-deleted,id="7"`)})
+	waitBp(t, bps, "7", false)
+
+	if _, err := bps.Insert(ctx, "main.go:1", &BreakpointOpts{Thread: "1\n-gdb-exit"}); !errors.Is(err, ErrBadNumber) {
+		t.Errorf("Insert with a bad thread: got %v", err)
+	}
+	for _, n := range []string{"1\n-gdb-exit", "1 2", ""} {
+		if err := bps.Delete(ctx, n); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("Delete(%q): got %v", n, err)
+		}
+		if err := bps.Condition(ctx, n, "x > 1"); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("Condition(%q): got %v", n, err)
+		}
+		if err := bps.After(ctx, n, 1); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("After(%q): got %v", n, err)
+		}
+	}
+	if err := bps.Enable(ctx); err == nil {
+		t.Error("Enable without a breakpoint succeeded")
+	}
+}
+
+func waitBp(t *testing.T, bps *Breakpoints, number string, present bool) {
+	t.Helper()
+	ctx := testCtx(t)
+	for {
+		if _, ok := bps.Get(number); ok == present {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("breakpoint %s present: %v, want %v", number, !present, present)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package gdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A memory address reported by the GDB. Marshalled to JSON as a hex
+// string so it survives the trip to the browser intact.
+type Addr uint64
+
+func (a Addr) String() string {
+	return fmt.Sprintf("0x%016x", uint64(a))
+}
+
+func (a Addr) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + a.String() + `"`), nil
+}
+
+// A local, argument or child value, e.g. from -stack-list-variables.
+type Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Arg   bool   `json:"arg,omitempty"`
+}
+
+// A stack frame. Variables is only set when explicitly collected.
+type Frame struct {
+	Level     int         `json:"level"`
+	Addr      Addr        `json:"addr"`
+	Func      string      `json:"func"`
+	File      string      `json:"file,omitempty"`
+	Fullname  string      `json:"fullname,omitempty"`
+	Line      int         `json:"line,omitempty"`
+	From      string      `json:"from,omitempty"`
+	Args      []*Variable `json:"args,omitempty"`
+	Variables []*Variable `json:"variables,omitempty"`
+}
+
+// An OS thread from -thread-info. Stack is only set when explicitly
+// collected.
+type Thread struct {
+	Id       string   `json:"id"`
+	TargetId string   `json:"target-id"`
+	Name     string   `json:"name,omitempty"`
+	State    string   `json:"state"`
+	Core     string   `json:"core,omitempty"`
+	Frame    *Frame   `json:"frame,omitempty"`
+	Stack    []*Frame `json:"stack,omitempty"`
+}
+
+// An entry in the GDB breakpoint table.
+type Breakpoint struct {
+	Number           string `json:"number"`
+	Type             string `json:"type"`
+	Disp             string `json:"disp"`
+	Enabled          bool   `json:"enabled"`
+	Addr             Addr   `json:"addr"`
+	Func             string `json:"func,omitempty"`
+	File             string `json:"file,omitempty"`
+	Fullname         string `json:"fullname,omitempty"`
+	Line             int    `json:"line,omitempty"`
+	Times            int    `json:"times"`
+	Cond             string `json:"cond,omitempty"`
+	Ignore           int    `json:"ignore,omitempty"`
+	Thread           string `json:"thread,omitempty"`
+	Pending          string `json:"pending,omitempty"`
+	OriginalLocation string `json:"original-location,omitempty"`
+}
+
+// The details of a *stopped exec record.
+type StoppedEvent struct {
+	Reason         string `json:"reason"`
+	ThreadId       string `json:"thread-id,omitempty"`
+	StoppedThreads string `json:"stopped-threads,omitempty"`
+	BkptNo         string `json:"bkptno,omitempty"`
+	ExitCode       int    `json:"exit-code,omitempty"`
+	SignalName     string `json:"signal-name,omitempty"`
+	SignalMeaning  string `json:"signal-meaning,omitempty"`
+	Frame          *Frame `json:"frame,omitempty"`
+}
+
+// Decodes the 'frame' tuple found in *stopped records, -thread-info
+// threads and -stack-list-frames stacks.
+func DecodeFrame(v interface{}) (*Frame, error) {
+
+	t, err := tupleOf("frame", v)
+	if err != nil {
+		return nil, err
+	}
+	f := &Frame{
+		Func:     str(t, "func"),
+		File:     str(t, "file"),
+		Fullname: str(t, "fullname"),
+		From:     str(t, "from"),
+	}
+	if f.Level, err = optInt(t, "level"); err != nil {
+		return nil, err
+	}
+	if f.Line, err = optInt(t, "line"); err != nil {
+		return nil, err
+	}
+	if f.Addr, err = optAddr(t, "addr"); err != nil {
+		return nil, err
+	}
+	if args, ok := t["args"]; ok {
+		if f.Args, err = decodeVariableList(args); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Decodes the result of -stack-list-frames.
+func DecodeStack(data map[string]interface{}) ([]*Frame, error) {
+
+	list, err := listOf("stack", data["stack"])
+	if err != nil {
+		return nil, err
+	}
+	stack := make([]*Frame, 0, len(list))
+	for _, v := range list {
+		f, err := DecodeFrame(v)
+		if err != nil {
+			return stack, err
+		}
+		stack = append(stack, f)
+	}
+	return stack, nil
+}
+
+// Decodes the result of -thread-info.
+func DecodeThreadInfo(data map[string]interface{}) (threads []*Thread, currentId string, err error) {
+
+	list, err := listOf("threads", data["threads"])
+	if err != nil {
+		return nil, "", err
+	}
+	threads = make([]*Thread, 0, len(list))
+	for _, v := range list {
+		t, err := tupleOf("thread", v)
+		if err != nil {
+			return threads, "", err
+		}
+		th := &Thread{
+			Id:       str(t, "id"),
+			TargetId: str(t, "target-id"),
+			Name:     str(t, "name"),
+			State:    str(t, "state"),
+			Core:     str(t, "core"),
+		}
+		if fv, ok := t["frame"]; ok {
+			if th.Frame, err = DecodeFrame(fv); err != nil {
+				return threads, "", err
+			}
+		}
+		threads = append(threads, th)
+	}
+	return threads, str(data, "current-thread-id"), nil
+}
+
+// Decodes the result of -stack-list-variables, -stack-list-locals
+// or -stack-list-arguments for a single frame.
+func DecodeVariables(data map[string]interface{}) ([]*Variable, error) {
+
+	for _, key := range []string{"variables", "locals", "args"} {
+		if v, ok := data[key]; ok {
+			return decodeVariableList(v)
+		}
+	}
+	return nil, fmt.Errorf("gdb: no variables found in %v", data)
+}
+
+// Decodes a 'bkpt' tuple from a -break-insert result or a
+// =breakpoint-created / =breakpoint-modified notification.
+func DecodeBreakpoint(v interface{}) (*Breakpoint, error) {
+
+	t, err := tupleOf("bkpt", v)
+	if err != nil {
+		return nil, err
+	}
+	b := &Breakpoint{
+		Number:           str(t, "number"),
+		Type:             str(t, "type"),
+		Disp:             str(t, "disp"),
+		Enabled:          str(t, "enabled") == "y",
+		Func:             str(t, "func"),
+		File:             str(t, "file"),
+		Fullname:         str(t, "fullname"),
+		Cond:             str(t, "cond"),
+		Thread:           str(t, "thread"),
+		Pending:          str(t, "pending"),
+		OriginalLocation: str(t, "original-location"),
+	}
+	if len(b.Number) == 0 {
+		return nil, fmt.Errorf("gdb: bkpt without number: %v", t)
+	}
+	if b.Line, err = optInt(t, "line"); err != nil {
+		return nil, err
+	}
+	if b.Times, err = optInt(t, "times"); err != nil {
+		return nil, err
+	}
+	if b.Ignore, err = optInt(t, "ignore"); err != nil {
+		return nil, err
+	}
+	if b.Addr, err = optAddr(t, "addr"); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Decodes a *stopped exec record.
+func DecodeStoppedEvent(r *Record) (*StoppedEvent, error) {
+
+	if r.Nature != NATURE_EXEC_OUT || r.Class != "stopped" {
+		return nil, fmt.Errorf("gdb: not a stopped record: %c%s", r.Nature, r.Class)
+	}
+	e := &StoppedEvent{
+		Reason:         str(r.Data, "reason"),
+		ThreadId:       str(r.Data, "thread-id"),
+		StoppedThreads: str(r.Data, "stopped-threads"),
+		BkptNo:         str(r.Data, "bkptno"),
+		SignalName:     str(r.Data, "signal-name"),
+		SignalMeaning:  str(r.Data, "signal-meaning"),
+	}
+	// the exit code is reported in octal, e.g. exit-code="01"
+	if s, ok := r.Data["exit-code"].(string); ok {
+		n, err := strconv.ParseInt(s, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("gdb: malformed exit-code: %q", s)
+		}
+		e.ExitCode = int(n)
+	}
+	var err error
+	if fv, ok := r.Data["frame"]; ok {
+		if e.Frame, err = DecodeFrame(fv); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// The exit status of the GDB process.
+type GdbExit struct {
+	ExitCode   int    `json:"exit-code"`
+	SignalName string `json:"signal-name,omitempty"`
+}
+
+// Decodes the =gdb-exited record published by a Ssn when its GDB
+// process ends. This record is not part of the MI, it is made up by
+// the Ssn.
+func DecodeGdbExit(r *Record) (*GdbExit, error) {
+
+	if r.Nature != NATURE_NOTIFY || r.Class != "gdb-exited" {
+		return nil, fmt.Errorf("gdb: not a gdb-exited record: %c%s", r.Nature, r.Class)
+	}
+	e := &GdbExit{SignalName: str(r.Data, "signal-name")}
+	var err error
+	if e.ExitCode, err = optInt(r.Data, "exit-code"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func decodeVariableList(v interface{}) ([]*Variable, error) {
+
+	list, err := listOf("variables", v)
+	if err != nil {
+		return nil, err
+	}
+	vars := make([]*Variable, 0, len(list))
+	for _, elm := range list {
+		t, err := tupleOf("variable", elm)
+		if err != nil {
+			return vars, err
+		}
+		vars = append(vars, &Variable{
+			Name:  str(t, "name"),
+			Value: str(t, "value"),
+			Type:  str(t, "type"),
+			Arg:   str(t, "arg") == "1",
+		})
+	}
+	return vars, nil
+}
+
+// Returns the tuple in v, looking through the name of a NamedValue
+// as found in lists of results, e.g. stack=[frame={...},frame={...}].
+func tupleOf(what string, v interface{}) (map[string]interface{}, error) {
+
+	if nv, ok := v.(NamedValue); ok {
+		v = nv.Data
+	}
+	t, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("gdb: unknown %s type: %T", what, v)
+	}
+	return t, nil
+}
+
+func listOf(what string, v interface{}) ([]interface{}, error) {
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("gdb: unknown %s type: %T", what, v)
+	}
+	return list, nil
+}
+
+// Returns the unescaped string value of key or "" if the key is not
+// present or is not a string.
+func str(t map[string]interface{}, key string) string {
+	s, _ := t[key].(string)
+	return unescape(s)
+}
+
+func optInt(t map[string]interface{}, key string) (int, error) {
+
+	s, ok := t[key].(string)
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("gdb: malformed %s: %q", key, s)
+	}
+	return n, nil
+}
+
+// Parses a hex address. Placeholders like <PENDING> or <MULTIPLE>
+// decode as 0.
+func optAddr(t map[string]interface{}, key string) (Addr, error) {
+
+	s, ok := t[key].(string)
+	if !ok || !strings.HasPrefix(s, "0x") {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s[2:], 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gdb: malformed %s: %q", key, s)
+	}
+	return Addr(n), nil
+}
+
+// Resolves the escape sequences in the contents of a c-string as
+// returned by the parser.
+func unescape(s string) string {
+
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			b = append(b, c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'n':
+			b = append(b, '\n')
+		case 't':
+			b = append(b, '\t')
+		case 'r':
+			b = append(b, '\r')
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'v':
+			b = append(b, '\v')
+		case 'e':
+			b = append(b, 033)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n, j := 0, i
+			for ; j < len(s) && j < i+3 && '0' <= s[j] && s[j] <= '7'; j++ {
+				n = n*8 + int(s[j]-'0')
+			}
+			b = append(b, byte(n))
+			i = j - 1
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,158 @@
+package gdb
+
+import (
+	"testing"
+)
+
+func parseRecord(t *testing.T, line string) *Record {
+	t.Helper()
+	r, err := ParseGdbRecord(line)
+	if err != nil {
+		t.Fatalf("ParseGdbRecord(%q): %v", line, err)
+	}
+	return r
+}
+
+func TestDecodeStoppedEvent(t *testing.T) {
+
+	tests := []struct {
+		line string
+		want StoppedEvent
+		file string
+		fn   string
+		ln   int
+	}{
+		{
+			line: `*stopped,reason="breakpoint-hit",disp="keep",bkptno="1",frame={addr="0x0000000000401000",func="main.main",args=[],file="main.go",fullname="/src/main.go",line="7"},thread-id="1",stopped-threads="all",core="0"`,
+			want: StoppedEvent{Reason: "breakpoint-hit", ThreadId: "1", StoppedThreads: "all", BkptNo: "1"},
+			file: "main.go",
+			fn:   "main.main",
+			ln:   7,
+		},
+		{
+			line: `*stopped,reason="exited",exit-code="012"`,
+			want: StoppedEvent{Reason: "exited", ExitCode: 10},
+		},
+		{
+			line: `*stopped,reason="exited-normally"`,
+			want: StoppedEvent{Reason: "exited-normally"},
+		},
+		{
+			line: `*stopped,reason="signal-received",signal-name="SIGSEGV",signal-meaning="Segmentation fault",frame={addr="0x10",func="f",args=[]},thread-id="2",stopped-threads="all"`,
+			want: StoppedEvent{Reason: "signal-received", ThreadId: "2", StoppedThreads: "all", SignalName: "SIGSEGV", SignalMeaning: "Segmentation fault"},
+			fn:   "f",
+		},
+	}
+
+	for _, tt := range tests {
+		ev, err := DecodeStoppedEvent(parseRecord(t, tt.line))
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		got := *ev
+		got.Frame = nil
+		if got != tt.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.line, got, tt.want)
+		}
+		if len(tt.fn) == 0 {
+			continue
+		}
+		if ev.Frame == nil {
+			t.Errorf("%s: no frame", tt.line)
+			continue
+		}
+		if ev.Frame.Func != tt.fn || ev.Frame.File != tt.file || ev.Frame.Line != tt.ln {
+			t.Errorf("%s: frame %+v", tt.line, ev.Frame)
+		}
+	}
+}
+
+func TestDecodeStoppedEventErrors(t *testing.T) {
+
+	for _, line := range []string{
+		`*running,thread-id="all"`,
+		`=stopped,reason="exited"`,
+		`*stopped,reason="exited",exit-code="9"`,
+		`*stopped,reason="end-stepping-range",frame="main.go"`,
+	} {
+		if _, err := DecodeStoppedEvent(parseRecord(t, line)); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestDecodeBreakpoint(t *testing.T) {
+
+	r := parseRecord(t, `^done,bkpt={number="2",type="breakpoint",disp="keep",enabled="y",addr="0x000000000040105a",func="main.f",file="main.go",fullname="/src/main.go",line="12",thread-groups=["i1"],cond="x > 1",times="3",ignore="4",original-location="main.go:12"}`)
+	bp, err := DecodeBreakpoint(r.Data["bkpt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Breakpoint{
+		Number:           "2",
+		Type:             "breakpoint",
+		Disp:             "keep",
+		Enabled:          true,
+		Addr:             0x40105a,
+		Func:             "main.f",
+		File:             "main.go",
+		Fullname:         "/src/main.go",
+		Line:             12,
+		Times:            3,
+		Cond:             "x > 1",
+		Ignore:           4,
+		OriginalLocation: "main.go:12",
+	}
+	if *bp != want {
+		t.Errorf("got  %+v\nwant %+v", *bp, want)
+	}
+
+	r = parseRecord(t, `=breakpoint-created,bkpt={number="3",type="breakpoint",disp="keep",enabled="n",addr="<PENDING>",pending="nosuch.go:1",times="0",original-location="nosuch.go:1"}`)
+	bp, err = DecodeBreakpoint(r.Data["bkpt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp.Enabled || bp.Pending != "nosuch.go:1" || bp.Addr != 0 {
+		t.Errorf("pending breakpoint: %+v", *bp)
+	}
+
+	for _, line := range []string{
+		`^done,bkpt={type="breakpoint"}`,
+		`^done,bkpt={number="1",line="x"}`,
+		`^done,bkpt="1"`,
+	} {
+		if _, err := DecodeBreakpoint(parseRecord(t, line).Data["bkpt"]); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestDecodeThreadInfo(t *testing.T) {
+
+	r := parseRecord(t, `^done,threads=[{id="2",target-id="Thread 0x7ffff7fb6700 (LWP 2)",name="prog",frame={level="0",addr="0x0000000000401000",func="runtime.futex",args=[],file="sys_linux_amd64.s",line="557"},state="stopped",core="1"},{id="1",target-id="Thread 0x7ffff7fb7740 (LWP 1)",state="running"}],current-thread-id="1"`)
+	threads, cur, err := DecodeThreadInfo(r.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != "1" {
+		t.Errorf("current thread %q, want 1", cur)
+	}
+	if len(threads) != 2 {
+		t.Fatalf("got %d threads, want 2", len(threads))
+	}
+	th := threads[0]
+	if th.Id != "2" || th.Name != "prog" || th.State != "stopped" || th.Core != "1" || th.TargetId != "Thread 0x7ffff7fb6700 (LWP 2)" {
+		t.Errorf("thread: %+v", th)
+	}
+	if th.Frame == nil || th.Frame.Func != "runtime.futex" || th.Frame.Line != 557 {
+		t.Errorf("frame: %+v", th.Frame)
+	}
+	if threads[1].Frame != nil || threads[1].State != "running" {
+		t.Errorf("running thread: %+v", threads[1])
+	}
+
+	if _, _, err = DecodeThreadInfo(parseRecord(t, `^done,threads="none"`).Data); err == nil {
+		t.Error("expected an error for malformed threads")
+	}
+}
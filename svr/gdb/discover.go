@@ -0,0 +1,119 @@
+package gdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Oldest GDB known to work, older versions lack parts of the MI and
+// Python support used by nvlv and runtime-gdb.py.
+var MinGdbVersion = []int{7, 5}
+
+var gdbVersionRe = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// Resolves GdbBinPath, RuntimeGdbPy and GdbServerPath. An empty
+// GdbBinPath is looked up on the PATH and an empty RuntimeGdbPy is
+// searched for in the GOROOT reported by 'go env GOROOT'. Returns an
+// error describing what is missing or when the GDB is older than
+// MinGdbVersion. The gdbserver is optional, an empty GdbServerPath is
+// left empty when there is none on the PATH.
+func Discover() error {
+
+	gdbPath := GdbBinPath
+	if len(gdbPath) == 0 {
+		gdbPath = "gdb"
+	}
+	p, err := exec.LookPath(gdbPath)
+	if err != nil {
+		return fmt.Errorf("gdb not found (%v), install it or pass its path with -gdb", err)
+	}
+	GdbBinPath = p
+
+	version, err := GdbVersion(GdbBinPath)
+	if err != nil {
+		return err
+	}
+	if versionLess(version, MinGdbVersion) {
+		return fmt.Errorf("%s is version %s, need at least %s", GdbBinPath, joinVersion(version), joinVersion(MinGdbVersion))
+	}
+
+	if len(RuntimeGdbPy) == 0 {
+		if RuntimeGdbPy, err = findRuntimeGdbPy(); err != nil {
+			return err
+		}
+	} else if _, err = os.Stat(RuntimeGdbPy); err != nil {
+		return fmt.Errorf("Go runtime support script: %v", err)
+	}
+
+	if len(GdbServerPath) == 0 {
+		GdbServerPath, _ = exec.LookPath("gdbserver")
+	} else if GdbServerPath, err = exec.LookPath(GdbServerPath); err != nil {
+		return fmt.Errorf("gdbserver not found: %v", err)
+	}
+	return nil
+}
+
+// Returns the major and minor version from 'gdb --version', which
+// starts with a line like "GNU gdb (Ubuntu 12.1-0ubuntu1) 12.1".
+func GdbVersion(gdbPath string) ([]int, error) {
+
+	out, err := exec.Command(gdbPath, "--version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to run %s --version: %v", gdbPath, err)
+	}
+	line := strings.SplitN(string(out), "\n", 2)[0]
+	m := gdbVersionRe.FindAllStringSubmatch(line, -1)
+	if m == nil {
+		return nil, fmt.Errorf("unable to find the version of %s in %q", gdbPath, line)
+	}
+	last := m[len(m)-1]
+	major, _ := strconv.Atoi(last[1])
+	minor, _ := strconv.Atoi(last[2])
+	return []int{major, minor}, nil
+}
+
+func findRuntimeGdbPy() (string, error) {
+
+	goroot := runtime.GOROOT()
+	if out, err := exec.Command("go", "env", "GOROOT").Output(); err == nil {
+		goroot = strings.TrimSpace(string(out))
+	}
+	if len(goroot) == 0 {
+		return "", errors.New("unable to find GOROOT, pass the path of runtime-gdb.py with -runtime-gdb-py")
+	}
+	// src/pkg/runtime before Go 1.4
+	candidates := []string{
+		filepath.Join(goroot, "src", "runtime", "runtime-gdb.py"),
+		filepath.Join(goroot, "src", "pkg", "runtime", "runtime-gdb.py"),
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("runtime-gdb.py not found in %s, pass its path with -runtime-gdb-py", goroot)
+}
+
+func versionLess(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func joinVersion(v []int) string {
+	s := make([]string, len(v))
+	for i, n := range v {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ".")
+}
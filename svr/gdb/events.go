@@ -0,0 +1,168 @@
+package gdb
+
+import (
+	"strings"
+	"sync"
+)
+
+// A subscription to the out-of-band records (exec, status, notify and
+// stream) output by the GDB. Matching records are queued without limit
+// so a slow reader never blocks the GDB output loop or misses a record.
+// C is closed after Unsubscribe or when the session is closed, Kill
+// leaves it open so records keep coming after a Restart.
+type Subscription struct {
+	C       <-chan *Record
+	c       chan *Record
+	natures string
+	classes []string
+	mtx     *sync.Mutex
+	queue   []*Record
+	wake    chan bool
+	done    chan bool
+	closed  bool
+}
+
+func newSubscription(natures []byte, classes []string) *Subscription {
+	c := make(chan *Record)
+	s := &Subscription{
+		C:       c,
+		c:       c,
+		natures: string(natures),
+		classes: classes,
+		mtx:     &sync.Mutex{},
+		wake:    make(chan bool, 1),
+		done:    make(chan bool),
+	}
+	go s.pump()
+	return s
+}
+
+// Returns true when the record's nature is one of the subscribed
+// natures (or none were given) and its class is one of the subscribed
+// classes (or none were given).
+func (s *Subscription) matches(r *Record) bool {
+
+	if len(s.natures) > 0 && strings.IndexByte(s.natures, r.Nature) < 0 {
+		return false
+	}
+	if len(s.classes) == 0 {
+		return true
+	}
+	for _, c := range s.classes {
+		if c == r.Class {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) push(r *Record) {
+	s.mtx.Lock()
+	if !s.closed {
+		s.queue = append(s.queue, r)
+	}
+	s.mtx.Unlock()
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+func (s *Subscription) close() {
+	s.mtx.Lock()
+	if !s.closed {
+		s.closed = true
+		s.queue = nil
+		close(s.done)
+	}
+	s.mtx.Unlock()
+}
+
+// Moves queued records to C until the subscription is closed.
+func (s *Subscription) pump() {
+
+	defer close(s.c)
+	for {
+		s.mtx.Lock()
+		if s.closed {
+			s.mtx.Unlock()
+			return
+		}
+		if len(s.queue) == 0 {
+			s.mtx.Unlock()
+			select {
+			case <-s.wake:
+			case <-s.done:
+			}
+			continue
+		}
+		r := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mtx.Unlock()
+
+		select {
+		case s.c <- r:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Fans out the out-of-band records of each GDB output to the matching
+// subscriptions.
+type eventBus struct {
+	mtx    *sync.Mutex
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{&sync.Mutex{}, make(map[*Subscription]bool), false}
+}
+
+func (b *eventBus) subscribe(natures []byte, classes []string) *Subscription {
+	s := newSubscription(natures, classes)
+	b.mtx.Lock()
+	if b.closed {
+		s.close()
+	} else {
+		b.subs[s] = true
+	}
+	b.mtx.Unlock()
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *Subscription) {
+	b.mtx.Lock()
+	delete(b.subs, s)
+	b.mtx.Unlock()
+	s.close()
+}
+
+// Result records are not published, they are the response to a
+// command and belong to whoever issued it.
+func (b *eventBus) publish(recs []*Record) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, r := range recs {
+		if r.Nature == NATURE_RESULT || len(r.ParseError) > 0 {
+			continue
+		}
+		for s := range b.subs {
+			if s.matches(r) {
+				s.push(r)
+			}
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.mtx.Lock()
+	b.closed = true
+	for s := range b.subs {
+		s.close()
+	}
+	b.subs = make(map[*Subscription]bool)
+	b.mtx.Unlock()
+}
@@ -0,0 +1,108 @@
+package gdb
+
+import (
+	"testing"
+	"time"
+)
+
+func recvRecord(t *testing.T, s *Subscription) *Record {
+	t.Helper()
+	select {
+	case r, ok := <-s.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no record")
+	}
+	return nil
+}
+
+func expectClosed(t *testing.T, s *Subscription) {
+	t.Helper()
+	select {
+	case r, ok := <-s.C:
+		if ok {
+			t.Fatalf("got %v, want the subscription closed", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed")
+	}
+}
+
+func TestEventBusFilters(t *testing.T) {
+
+	b := newEventBus()
+	stops := b.subscribe([]byte{NATURE_EXEC_OUT}, []string{"stopped"})
+	notes := b.subscribe([]byte{NATURE_NOTIFY}, nil)
+	all := b.subscribe(nil, nil)
+	defer b.close()
+
+	b.publish(ParseGdbOutput("^done\n*running,thread-id=\"all\"\n=thread-created,id=\"1\"\n*stopped,reason=\"exited-normally\"\n~\"hi\\n\"\n(gdb)\n"))
+
+	if r := recvRecord(t, stops); r.Class != "stopped" {
+		t.Errorf("stops got %c%s", r.Nature, r.Class)
+	}
+	if r := recvRecord(t, notes); r.Class != "thread-created" {
+		t.Errorf("notes got %c%s", r.Nature, r.Class)
+	}
+	// everything but the result, in order
+	want := []byte{NATURE_EXEC_OUT, NATURE_NOTIFY, NATURE_EXEC_OUT, NATURE_CONSOLE_STRM}
+	for i, n := range want {
+		if r := recvRecord(t, all); r.Nature != n {
+			t.Errorf("record %d: got %c, want %c", i, r.Nature, n)
+		}
+	}
+	select {
+	case r := <-stops.C:
+		t.Errorf("stops got another record: %v", r)
+	case r := <-all.C:
+		t.Errorf("all got another record: %v", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestEventBusSlowReader(t *testing.T) {
+
+	b := newEventBus()
+	s := b.subscribe(nil, nil)
+	defer b.close()
+
+	// nobody reads while the records are published, none are dropped
+	for i := 0; i < 1000; i++ {
+		b.publish([]*Record{{Nature: NATURE_NOTIFY, Class: "n"}})
+	}
+	for i := 0; i < 1000; i++ {
+		recvRecord(t, s)
+	}
+}
+
+func TestEventBusUnsubscribeAndClose(t *testing.T) {
+
+	b := newEventBus()
+	s1 := b.subscribe(nil, nil)
+	s2 := b.subscribe(nil, nil)
+
+	b.unsubscribe(s1)
+	expectClosed(t, s1)
+	b.publish([]*Record{{Nature: NATURE_NOTIFY, Class: "n"}})
+	recvRecord(t, s2)
+	// unsubscribing twice is fine
+	b.unsubscribe(s1)
+
+	b.close()
+	expectClosed(t, s2)
+	expectClosed(t, b.subscribe(nil, nil))
+}
+
+func TestSubscriptionsOutliveKill(t *testing.T) {
+
+	ssn := startFakeGdb(t)
+	s := ssn.Subscribe([]byte{NATURE_NOTIFY}, "gdb-exited")
+	ssn.Kill()
+	recvRecord(t, s)
+
+	ssn.Close()
+	expectClosed(t, s)
+}
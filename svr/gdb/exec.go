@@ -0,0 +1,75 @@
+package gdb
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrGdbExited = errors.New("gdb: exited")
+
+// Resumes the program until the next breakpoint, or backwards to the
+// previous one when reverse is set and the target supports it.
+func (ssn *Ssn) Continue(ctx context.Context, reverse bool) (*StoppedEvent, error) {
+	return ssn.execAndWait(ctx, "-exec-continue", reverse)
+}
+
+// Steps over the current source line.
+func (ssn *Ssn) Next(ctx context.Context, reverse bool) (*StoppedEvent, error) {
+	return ssn.execAndWait(ctx, "-exec-next", reverse)
+}
+
+// Steps into the current source line.
+func (ssn *Ssn) Step(ctx context.Context, reverse bool) (*StoppedEvent, error) {
+	return ssn.execAndWait(ctx, "-exec-step", reverse)
+}
+
+// Runs until the current function returns.
+func (ssn *Ssn) Finish(ctx context.Context, reverse bool) (*StoppedEvent, error) {
+	return ssn.execAndWait(ctx, "-exec-finish", reverse)
+}
+
+// Runs until a source line past the current one is reached, or until
+// location when one is given.
+func (ssn *Ssn) Until(ctx context.Context, location string) (*StoppedEvent, error) {
+	cmd := "-exec-until"
+	if len(location) > 0 {
+		cmd += " " + quote(location)
+	}
+	return ssn.execAndWait(ctx, cmd, false)
+}
+
+// Stops the running program.
+func (ssn *Ssn) Interrupt(ctx context.Context) (*StoppedEvent, error) {
+	return ssn.execAndWait(ctx, "-exec-interrupt", false)
+}
+
+// Issues an exec command and waits for the *stopped record that ends
+// it. Subscribes before the command is sent so the stop can't be missed.
+// Gives up if the GDB exits first.
+func (ssn *Ssn) execAndWait(ctx context.Context, cmd string, reverse bool) (*StoppedEvent, error) {
+
+	if ssn.Target().Mode == MODE_CORE {
+		return nil, ErrCoreTarget
+	}
+	if reverse {
+		cmd += " --reverse"
+	}
+	sub := ssn.Subscribe([]byte{NATURE_EXEC_OUT, NATURE_NOTIFY}, "stopped", "gdb-exited")
+	defer ssn.Unsubscribe(sub)
+
+	if _, _, err := ssn.GetResponseContext(ctx, cmd); err != nil {
+		return nil, err
+	}
+	select {
+	case r, ok := <-sub.C:
+		if !ok {
+			return nil, ErrIoEnded
+		}
+		if r.Class == "gdb-exited" {
+			return nil, ErrGdbExited
+		}
+		return DecodeStoppedEvent(r)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -1,24 +1,64 @@
 package gdb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/tiffon/nvlv/svr/cmn"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-var GdbBinPath string = "/_assets/tools/gdb/gdb-7.5/build/gdb/gdb"
+// The gdb binary, looked up on the PATH by Discover when empty.
+var GdbBinPath string
 
-var RuntimeGdbPy string = "/usr/local/go/src/pkg/runtime/runtime-gdb.py"
+// The Go runtime support script, found in the GOROOT by Discover when
+// empty.
+var RuntimeGdbPy string
 
 var ErrIsStarted = errors.New("is started")
 
 var ErrIsKilled = errors.New("is killed")
 
+var ErrNotStarted = errors.New("gdb: not started")
+
+var ErrIoEnded = errors.New("gdb: output loop ended")
+
+var ErrCantRestart = errors.New("gdb: an attached or remote target can't be restarted, attach or connect again")
+
+// Returned for program arguments and environment values that contain a
+// line break, which would end the MI command they are sent in.
+var ErrMultiline = errors.New("gdb: value spans lines")
+
+var ErrTokenReserved = errors.New("gdb: command tokens are reserved for the server, send the command without one")
+
+// The ^error result of a command.
+type MIError struct {
+	Cmd  string
+	Msg  string
+	Code string
+}
+
+func (e *MIError) Error() string {
+	return fmt.Sprintf("gdb: %s: %s", e.Cmd, e.Msg)
+}
+
+// Quotes s as a c-string so an MI command receives it as a single
+// argument.
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	s = strings.Replace(s, "\r", `\r`, -1)
+	return `"` + s + `"`
+}
+
 // type GdbState int
 
 // const (
@@ -39,7 +79,12 @@ type Ssn struct {
 	stateMtx    *sync.Mutex
 	execOutFile string
 	gdb         *cmn.CmdWrapper
-	tail        *cmn.CmdWrapper
+	// The terminal of the program being debugged, ptyDone is closed when
+	// ptyIoLoop is done with it.
+	pty     *cmn.Pty
+	ptyDone chan struct{}
+	// The gdbserver started by StartGdbServer, if any.
+	server *cmn.CmdWrapper
 	// Single line strings that are part of current GDB MI output, which is a multiline string. 
 	// The output is processed when the closing token is encountered.
 	// recentOutput []string
@@ -49,42 +94,88 @@ type Ssn struct {
 	errOutput      chan error
 	gdbOutput      chan *Msg
 	inferiorOutput chan string
+	inferiorInput  chan string
 	input          chan []string
+	events         *eventBus
+	// Commands waiting on a result record, keyed by token.
+	pendingMtx *sync.Mutex
+	pending    map[string]chan *Msg
+	ioDone     chan bool
+	// Cancelled by Kill, ends the GDB process and the loops.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Done channel of the context the session was started with.
+	outerDone <-chan struct{}
+	bkpts     *Breakpoints
+	varObjs   *VarObjs
+	target    *targetTracker
+	// What the session was started with and the launch settings made
+	// since, and the core file loaded, so Restart can bring it back.
+	parent   context.Context
+	fileExec string
+	launch   Launch
+	core     string
 }
 
+// The output of the program being debugged is also appended to
+// execOutFile, unless it is empty.
 func NewSsn(execOutFile string, onErr chan error) *Ssn {
-	var tail *cmn.CmdWrapper = nil
-	if len(execOutFile) > 0 {
-		tail = cmn.NewCmdWrapper(exec.Command("tail", "-f", execOutFile))
-	}
-	return &Ssn{
+	ssn := &Ssn{
 		499,
 		false,
 		false,
 		&sync.Mutex{},
 		execOutFile,
-		cmn.NewCmdWrapper(exec.Command("bash")),
-		tail,
+		nil,
+		nil,
+		nil,
+		nil,
 		// make([]string, 0, 11),
 		// make([][]*Record, 0),
 		onErr,
 		make(chan *Msg),
 		make(chan string),
+		make(chan string),
 		make(chan []string),
+		newEventBus(),
+		&sync.Mutex{},
+		make(map[string]chan *Msg),
+		make(chan bool),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		"",
+		Launch{},
+		"",
 	}
+	ssn.bkpts = newBreakpoints(ssn)
+	ssn.varObjs = newVarObjs(ssn)
+	ssn.target = newTargetTracker(ssn)
+	return ssn
 }
 
 func (ssn *Ssn) NewCmdToken() string {
+	ssn.pendingMtx.Lock()
 	ssn.cmdToken++
-	// return string(ssn.cmdToken)
-	return fmt.Sprintf("%d", ssn.cmdToken)
+	t := ssn.cmdToken
+	ssn.pendingMtx.Unlock()
+	return fmt.Sprintf("%d", t)
 }
 
 func (ssn *Ssn) IsStarted() bool {
+	ssn.stateMtx.Lock()
+	defer ssn.stateMtx.Unlock()
 	return ssn.started
 }
 
+// True once the session was killed or the GDB has exited.
 func (ssn *Ssn) IsKilled() bool {
+	ssn.stateMtx.Lock()
+	defer ssn.stateMtx.Unlock()
 	return ssn.killed
 }
 
@@ -100,11 +191,54 @@ func (ssn *Ssn) InferiorOutput() <-chan string {
 	return ssn.inferiorOutput
 }
 
-func (ssn *Ssn) Input() chan<- []string {
-	return ssn.input
+// Writes input typed by a user to the terminal of the program being
+// debugged, in the order given. Doesn't wait for the program to read it.
+func (ssn *Ssn) SendInferior(ctx context.Context, s string) error {
+	ssn.stateMtx.Lock()
+	ptyDone := ssn.ptyDone
+	ssn.stateMtx.Unlock()
+	if ptyDone == nil {
+		return ErrNotStarted
+	}
+	select {
+	case ssn.inferiorInput <- s:
+		return nil
+	case <-ptyDone:
+		return ErrIoEnded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ssn *Ssn) Breakpoints() *Breakpoints {
+	return ssn.bkpts
+}
+
+func (ssn *Ssn) VarObjs() *VarObjs {
+	return ssn.varObjs
+}
+
+// Subscribes to the out-of-band records output by the GDB that have
+// one of the given natures, e.g. NATURE_EXEC_OUT, and one of the given
+// classes, e.g. "stopped". No natures or no classes matches all.
+func (ssn *Ssn) Subscribe(natures []byte, classes ...string) *Subscription {
+	return ssn.events.subscribe(natures, classes)
+}
+
+func (ssn *Ssn) Unsubscribe(s *Subscription) {
+	ssn.events.unsubscribe(s)
 }
 
 func (ssn *Ssn) Start(fileExec string, args ...string) error {
+	return ssn.StartContext(context.Background(), fileExec, args...)
+}
+
+// Starts the GDB on fileExec, which may be empty, with args as the
+// arguments for the program. When ctx is done the session is closed.
+// When the GDB process ends a =gdb-exited record with its exit status
+// is published, see DecodeGdbExit. The program is run on a
+// pseudo-terminal, see InferiorOutput and SendInferior.
+func (ssn *Ssn) StartContext(ctx context.Context, fileExec string, args ...string) error {
 	ssn.stateMtx.Lock()
 	defer ssn.stateMtx.Unlock()
 
@@ -114,89 +248,286 @@ func (ssn *Ssn) Start(fileExec string, args ...string) error {
 	if ssn.killed {
 		return ErrIsKilled
 	}
+	// the args are set again with SetArgs on Restart
+	for i, a := range args {
+		if strings.ContainsAny(a, "\r\n") {
+			return fmt.Errorf("gdb: program argument %d: %w", i, ErrMultiline)
+		}
+	}
+	ssn.parent = ctx
+	ssn.outerDone = ctx.Done()
+	ssn.fileExec = fileExec
+	ssn.launch = Launch{Args: args}
+	return ssn.start()
+}
+
+// Starts the GDB as set up by StartContext, and the loops that serve it.
+// Called with stateMtx held.
+func (ssn *Ssn) start() error {
+
 	ssn.started = true
+	ssn.killed = false
+	ctx := ssn.parent
+	ssn.ctx, ssn.cancel = context.WithCancel(ctx)
 
-	err := ssn.gdb.Start()
+	pty, err := cmn.OpenPty()
 	if err != nil {
+		ssn.abortStart()
 		return err
 	}
+	ssn.pty = pty
+	ssn.ptyDone = make(chan struct{})
 
-	cmdStr := GdbBinPath + " --interpreter mi " + fileExec
-	gin := ssn.gdb.InChan()
-	gin <- cmdStr
-	gin <- "source " + RuntimeGdbPy
-	for _, arg := range args {
-		gin <- arg
+	argv := []string{"--interpreter=mi2"}
+	if len(ssn.fileExec) > 0 {
+		argv = append(argv, "--args", ssn.fileExec)
+		argv = append(argv, ssn.launch.Args...)
 	}
-
-	go ssn.readTail()
-	go ssn.gdbIoLoop()
+	ssn.gdb = cmn.NewCmdWrapper(exec.Command(GdbBinPath, argv...))
+	if err = ssn.gdb.StartContext(ssn.ctx); err != nil {
+		ssn.abortStart()
+		return err
+	}
+	gin := ssn.gdb.InChan()
+	gin <- "-inferior-tty-set " + quote(pty.SlavePath)
+	gin <- "-interpreter-exec console " + quote("source "+RuntimeGdbPy)
+
+	ssn.pendingMtx.Lock()
+	ssn.ioDone = make(chan bool)
+	ssn.pendingMtx.Unlock()
+
+	go ssn.ptyIoLoop(ssn.ctx, pty, ssn.ptyDone)
+	go ssn.gdbIoLoop(ssn.ctx, ssn.gdb, ssn.ioDone)
+	go ssn.waitGdb(ssn.gdb)
+	go func(inner <-chan struct{}) {
+		<-inner
+		// killed, for good only if whoever started it is done
+		if ctx.Err() != nil {
+			ssn.Close()
+		}
+	}(ssn.ctx.Done())
 
 	return nil
 }
 
+// Undoes what start did before it failed, the session is left as it
+// was before it was started. Called with stateMtx held.
+func (ssn *Ssn) abortStart() {
+	ssn.cancel()
+	if ssn.pty != nil {
+		ssn.pty.Close()
+		ssn.pty = nil
+	}
+	ssn.ptyDone = nil
+	ssn.gdb = nil
+	ssn.started = false
+}
+
+// Runs the program without waiting for the GDB to respond. Does
+// nothing before the session is started or when the target is a core
+// file, see RunContext, which reports those.
 func (ssn *Ssn) Run() {
+	ssn.stateMtx.Lock()
+	started, ctx := ssn.started, ssn.ctx
+	ssn.stateMtx.Unlock()
+	if !started || ssn.target.get().Mode == MODE_CORE {
+		return
+	}
+	done := ctx.Done()
 	go func(ssn *Ssn) {
-		ssn.input <- []string{"run > " + ssn.execOutFile}
+		select {
+		case ssn.input <- []string{"-exec-run"}:
+			ssn.target.update(func(t *Target) {
+				t.Mode = MODE_LAUNCH
+			})
+		case <-done:
+		}
 	}(ssn)
 }
 
+// Sends commands typed by a user, their output goes to GdbOutput. The
+// commands may not start with a token, those are how GetResponse tells
+// its results apart. Fails with ErrNotStarted before the session is
+// started and with ErrIoEnded once the GDB is gone.
+func (ssn *Ssn) SendRaw(ctx context.Context, cmd string) error {
+	for _, line := range strings.Split(cmd, "\n") {
+		line = strings.TrimLeft(line, " \t\r")
+		if len(line) > 0 && '0' <= line[0] && line[0] <= '9' {
+			return ErrTokenReserved
+		}
+	}
+	if !ssn.IsStarted() {
+		return ErrNotStarted
+	}
+	ssn.pendingMtx.Lock()
+	ioDone := ssn.ioDone
+	ssn.pendingMtx.Unlock()
+	select {
+	case ssn.input <- []string{cmd}:
+		return nil
+	case <-ioDone:
+		return ErrIoEnded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sets the arguments the program is run with. GDB passes them through
+// a shell so each is single quoted.
+func (ssn *Ssn) SetArgs(ctx context.Context, args []string) error {
+	quoted, err := quoteArgs(args)
+	if err != nil {
+		return err
+	}
+	if _, _, err = ssn.GetResponseContext(ctx, "-exec-arguments "+quoted); err != nil {
+		return err
+	}
+	ssn.stateMtx.Lock()
+	ssn.launch.Args = args
+	ssn.stateMtx.Unlock()
+	return nil
+}
+
+// Returns args single quoted for the shell and joined with spaces.
+func quoteArgs(args []string) (string, error) {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if strings.ContainsAny(a, "\r\n") {
+			return "", fmt.Errorf("gdb: program argument %d: %w", i, ErrMultiline)
+		}
+		quoted[i] = "'" + strings.Replace(a, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// Evaluates an expression in the current frame.
+func (ssn *Ssn) Evaluate(ctx context.Context, expr string) (string, error) {
+	i, resp, err := ssn.GetResponseContext(ctx, "-data-evaluate-expression "+quote(expr))
+	if err != nil {
+		return "", err
+	}
+	return str(resp.Records[i].Data, "value"), nil
+}
+
 // Issues a command to the GDB and returns the response. A token is generated and 
 // prepended to the cmd which how the response is identified. This is a synchronous 
-// call that blocks while processing output from the GDB. 
-func (ssn *Ssn) GetResponse(cmd string, d time.Duration) (idx int, resp *Msg, skipped [][]*Record, err error) {
+// call that blocks until the response arrives or d elapses.
+func (ssn *Ssn) GetResponse(cmd string, d time.Duration) (idx int, resp *Msg, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return ssn.GetResponseContext(ctx, cmd)
+}
+
+// Like GetResponse but gives up when ctx is done. Any number of calls can be
+// in flight at once, gdbIoLoop routes each result record to the caller
+// waiting on its token. An ^error result is returned as a *MIError.
+func (ssn *Ssn) GetResponseContext(ctx context.Context, cmd string) (idx int, resp *Msg, err error) {
 
-	skipped = make([][]*Record, 0)
+	if !ssn.IsStarted() {
+		return 0, nil, ErrNotStarted
+	}
 	token := ssn.NewCmdToken()
-	cmd = token + cmd
-	timeout := time.After(d)
-	out := ssn.GdbOutput()
-	ssn.Input() <- []string{cmd}
+	wait := make(chan *Msg, 1)
+	ssn.pendingMtx.Lock()
+	ssn.pending[token] = wait
+	ioDone := ssn.ioDone
+	ssn.pendingMtx.Unlock()
+
+	defer func() {
+		ssn.pendingMtx.Lock()
+		delete(ssn.pending, token)
+		ssn.pendingMtx.Unlock()
+	}()
+
+	select {
+	case ssn.input <- []string{token + cmd}:
+	case <-ioDone:
+		return 0, nil, ErrIoEnded
+	case <-ctx.Done():
+		return 0, nil, fmt.Errorf("gdb: %s: %w", cmd, ctx.Err())
+	}
 
-	for {
-		select {
+	select {
+	case resp = <-wait:
+	case <-ioDone:
+		return 0, nil, ErrIoEnded
+	case <-ctx.Done():
+		return 0, nil, fmt.Errorf("gdb: %s: %w", cmd, ctx.Err())
+	}
 
-		case r := <-out:
-			if i, ok := HasToken(r.Records, token); ok {
-				return i, r, skipped, err
-			} else {
-				skipped = append(skipped, r.Records)
-			}
+	idx, _ = HasToken(resp.Records, token)
+	if r := resp.Records[idx]; r.Class == "error" {
+		msg, _ := r.Data["msg"].(string)
+		code, _ := r.Data["code"].(string)
+		err = &MIError{cmd, unescape(msg), code}
+	}
+	return idx, resp, err
+}
 
-		case <-timeout:
-			err = errors.New("gdb: timeout")
-			return
+// Returns the channel of the command waiting on the result record in
+// recs, if there is one, and stops tracking it.
+func (ssn *Ssn) takePending(recs []*Record) chan *Msg {
+	ssn.pendingMtx.Lock()
+	defer ssn.pendingMtx.Unlock()
+	for _, r := range recs {
+		if r.Nature != NATURE_RESULT || len(r.Token) == 0 {
+			continue
+		}
+		if wait, ok := ssn.pending[r.Token]; ok {
+			delete(ssn.pending, r.Token)
+			return wait
 		}
 	}
-	panic("unreachable")
+	return nil
 }
 
-func (ssn *Ssn) GetFrameVars(threadId, frameLvl string, timeout time.Duration) (fVars []interface{}, skipped [][]*Record, err error) {
+func (ssn *Ssn) GetFrameVars(threadId string, frameLvl int, timeout time.Duration) (fVars []*Variable, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return ssn.GetFrameVarsContext(ctx, threadId, frameLvl)
+}
 
-	cmd := fmt.Sprintf("-stack-list-variables --thread %s --frame %s --all-values", threadId, frameLvl)
-	i, resp, skipped, err := ssn.GetResponse(cmd, timeout)
-	if err != nil {
+// Lists the arguments and locals of a frame. Only simple values are
+// included, structs, slices and the like have just their type and are
+// expanded with variable objects, see VarObjs.
+func (ssn *Ssn) GetFrameVarsContext(ctx context.Context, threadId string, frameLvl int) (fVars []*Variable, err error) {
+
+	if err = checkThreadId(threadId); err != nil {
 		return
 	}
-
-	fVars, ok := resp.Records[i].Data["variables"].([]interface{})
-	if !ok {
-		err = fmt.Errorf("unknown frame-vars type: %t", resp.Records[i].Data["variables"])
+	cmd := fmt.Sprintf("-stack-list-variables --thread %s --frame %d --simple-values", threadId, frameLvl)
+	i, resp, err := ssn.GetResponseContext(ctx, cmd)
+	if err != nil {
+		return
 	}
+	fVars, err = DecodeVariables(resp.Records[i].Data)
 	return
 }
 
-func (ssn *Ssn) gdbIoLoop() {
+// Owns the GDB's stdin and stdout. Results of commands issued through
+// GetResponse go to the waiting caller, everything else is queued for
+// GdbOutput so a slow reader never stalls a pending command.
+func (ssn *Ssn) gdbIoLoop(ctx context.Context, g *cmn.CmdWrapper, ioDone chan bool) {
+
+	defer close(ioDone)
 
 	getInput := ssn.input
-	sendInput := ssn.gdb.InChan()
-	getOutput := ssn.gdb.OutChan()
-	sendOutput := ssn.gdbOutput
-	getErr := ssn.gdb.ErrChan()
+	sendInput := g.InChan()
+	getOutput := g.OutChan()
+	getErr := g.ErrChan()
+	done := ctx.Done()
 	recentMsgs := make([]string, 0, 11)
+	backlog := make([]*Msg, 0)
 
 	var err error = nil
 	for err == nil {
+		var sendOutput chan *Msg
+		var next *Msg
+		if len(backlog) > 0 {
+			sendOutput = ssn.gdbOutput
+			next = backlog[0]
+		}
+
 		select {
 		case xs, ok := <-getInput:
 			if !ok {
@@ -204,9 +535,16 @@ func (ssn *Ssn) gdbIoLoop() {
 				break
 			}
 			for _, s := range xs {
-				sendInput <- s
+				select {
+				case sendInput <- s:
+				case <-done:
+				}
 			}
 
+		case sendOutput <- next:
+			backlog[0] = nil
+			backlog = backlog[1:]
+
 		case m := <-getOutput:
 			if m.Err != nil {
 				err = m.Err
@@ -219,67 +557,287 @@ func (ssn *Ssn) gdbIoLoop() {
 					recentMsgs[i] = ""
 				}
 				recentMsgs = recentMsgs[:0]
-				sendOutput <- &Msg{ParseGdbOutput(rawGdbOut), rawGdbOut}
+				msg := &Msg{ParseGdbOutput(rawGdbOut), rawGdbOut}
+				ssn.events.publish(msg.Records)
+				if wait := ssn.takePending(msg.Records); wait != nil {
+					wait <- msg
+				} else {
+					backlog = append(backlog, msg)
+				}
 			}
 
 		case m := <-getErr:
+			// warnings and the like, passed on as log stream output
 			if len(m.Msg) > 0 {
-				err = errors.New("tail: " + m.Msg)
-			} else {
-				err = m.Err
+				line := strings.TrimRight(m.Msg, "\n")
+				r := &Record{Nature: NATURE_LOG_STRM, Stream: line}
+				ssn.events.publish([]*Record{r})
+				backlog = append(backlog, &Msg{[]*Record{r}, m.Msg})
+			}
+			if m.Err != nil {
+				getErr = nil
 			}
+
+		case <-done:
+			err = ctx.Err()
 		}
 	}
-	if err != nil && err != io.EOF {
+	if err == io.EOF {
+		// the GDB ended on its own
+		ssn.kill(g)
+	} else if err != nil && err != context.Canceled {
 		ssn.handleErr(err)
 	}
 }
 
-func (ssn *Ssn) readTail() {
+// Marks the session killed and publishes a =gdb-exited record once the
+// GDB process has ended, unless Restart replaced it.
+func (ssn *Ssn) waitGdb(g *cmn.CmdWrapper) {
+	<-g.Exited()
+	if !ssn.kill(g) {
+		return
+	}
+	st := g.ExitStatus()
+	r := &Record{
+		Nature: NATURE_NOTIFY,
+		Class:  "gdb-exited",
+		Data: map[string]interface{}{
+			"exit-code": strconv.Itoa(st.Code),
+		},
+	}
+	if len(st.Signal) > 0 {
+		r.Data["signal-name"] = st.Signal
+	}
+	ssn.events.publish([]*Record{r})
+}
 
-	ssn.stateMtx.Lock()
-	getOutput := ssn.tail.OutChan()
-	getError := ssn.tail.ErrChan()
-	sendOutput := ssn.inferiorOutput
-	ssn.tail.Start()
-	ssn.stateMtx.Unlock()
+// Passes the program's terminal output to InferiorOutput, and appends
+// it to the execOutFile, and writes the input from SendInferior to its
+// terminal. Both directions are queued so the loop is always ready for
+// more of either, a program that doesn't read its input or a client that
+// is slow to take the output holds nothing else up.
+func (ssn *Ssn) ptyIoLoop(ctx context.Context, pty *cmn.Pty, ptyDone chan struct{}) {
+
+	defer close(ptyDone)
 
+	var tee io.Writer = ioutil.Discard
+	if len(ssn.execOutFile) > 0 {
+		f, err := os.OpenFile(ssn.execOutFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			ssn.handleErr(err)
+			return
+		}
+		defer f.Close()
+		tee = f
+	}
+
+	master := pty.Master
+	done := ctx.Done()
+	output := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				select {
+				case output <- string(buf[:n]):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	writes := make(chan string)
+	writeErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case s := <-writes:
+				if _, err := master.Write([]byte(s)); err != nil {
+					writeErr <- err
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	outBacklog := make([]string, 0)
+	inBacklog := make([]string, 0)
 	var err error = nil
 	for err == nil {
+		var sendOutput, sendWrite chan string
+		var nextOut, nextIn string
+		if len(outBacklog) > 0 {
+			sendOutput = ssn.inferiorOutput
+			nextOut = outBacklog[0]
+		}
+		if len(inBacklog) > 0 {
+			sendWrite = writes
+			nextIn = inBacklog[0]
+		}
+
 		select {
-		case m := <-getOutput:
-			if m.Err != nil {
-				err = m.Err
-			} else {
-				sendOutput <- m.Msg
-			}
+		case s := <-output:
+			tee.Write([]byte(s))
+			outBacklog = append(outBacklog, s)
 
-		case m := <-getError:
-			if len(m.Msg) > 0 {
-				err = errors.New("tail: " + m.Msg)
-			} else {
-				err = m.Err
-			}
+		case sendOutput <- nextOut:
+			outBacklog = outBacklog[1:]
+
+		case s := <-ssn.inferiorInput:
+			inBacklog = append(inBacklog, s)
+
+		case sendWrite <- nextIn:
+			inBacklog = inBacklog[1:]
+
+		case err = <-readErr:
+
+		case err = <-writeErr:
+
+		case <-done:
+			err = ctx.Err()
 		}
 	}
-	if err != nil && err != io.EOF {
+	if err != nil && err != io.EOF && err != context.Canceled && !errors.Is(err, os.ErrClosed) {
 		ssn.handleErr(err)
 	}
 }
 
+// Kills the session and reports err unless whoever started the session
+// is no longer interested.
 func (ssn *Ssn) handleErr(err error) {
 	ssn.Kill()
-	ssn.errOutput <- err
+	select {
+	case ssn.errOutput <- err:
+	case <-ssn.outerDone:
+	}
 }
 
+// Ends the GDB and the program being debugged. Subscriptions stay open
+// so the session can be brought back with Restart.
 func (ssn *Ssn) Kill() {
+	ssn.kill(nil)
+}
+
+// Kills the session, when g is given only if it is still the session's
+// GDB and not one that was replaced by Restart. Returns whether it did.
+func (ssn *Ssn) kill(g *cmn.CmdWrapper) bool {
 	ssn.stateMtx.Lock()
-	if ssn.gdb.IsStarted() && !ssn.gdb.IsKilled() {
-		ssn.gdb.KillRelease()
+	defer ssn.stateMtx.Unlock()
+	if g != nil && g != ssn.gdb {
+		return false
+	}
+	ssn.killLocked()
+	return true
+}
+
+// Called with stateMtx held.
+func (ssn *Ssn) killLocked() {
+	if ssn.cancel != nil {
+		ssn.cancel()
+	}
+	if ssn.gdb != nil && ssn.gdb.IsStarted() && !ssn.gdb.IsKilled() {
+		ssn.gdb.Kill()
+	}
+	if ssn.pty != nil {
+		ssn.pty.Close()
+		ssn.pty = nil
 	}
-	if ssn.tail.IsStarted() && !ssn.tail.IsKilled() {
-		ssn.tail.KillRelease()
+	if ssn.server != nil {
+		ssn.server.Kill()
+		ssn.server = nil
 	}
 	ssn.killed = true
+}
+
+// Kills the session for good and closes the subscriptions.
+func (ssn *Ssn) Close() {
+	ssn.Kill()
+	ssn.events.close()
+}
+
+// Kills the GDB if it is still running and starts a new one on the same
+// executable, with the same program arguments, environment and working
+// directory, loads the same core file, if any, and inserts the
+// breakpoints again. Variable objects don't survive. An attached or
+// remote target is not brought back, see ErrCantRestart. The session
+// lives on until the context it was first started with is done, ctx only
+// bounds the restart itself.
+func (ssn *Ssn) Restart(ctx context.Context) error {
+
+	ssn.stateMtx.Lock()
+	if !ssn.started {
+		ssn.stateMtx.Unlock()
+		return ErrNotStarted
+	}
+	parent, launch, core := ssn.parent, ssn.launch, ssn.core
 	ssn.stateMtx.Unlock()
+	if parent.Err() != nil {
+		return ErrIsKilled
+	}
+	mode := ssn.target.get().Mode
+	if mode == MODE_ATTACH || mode == MODE_REMOTE {
+		return ErrCantRestart
+	}
+	bps := ssn.bkpts.List()
+
+	// the old GDB is let go of as it is killed so its end isn't taken for
+	// the session's, see waitGdb
+	ssn.stateMtx.Lock()
+	old := ssn.gdb
+	ssn.killLocked()
+	ssn.gdb = nil
+	ssn.stateMtx.Unlock()
+	// the old loops and process must be gone before new ones start
+	ssn.pendingMtx.Lock()
+	ioDone := ssn.ioDone
+	ssn.pendingMtx.Unlock()
+	select {
+	case <-ioDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if old != nil && old.IsStarted() {
+		select {
+		case <-old.Exited():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	ssn.bkpts.reset()
+	ssn.varObjs.reset()
+	ssn.target.reset()
+	ssn.stateMtx.Lock()
+	err := ssn.start()
+	ssn.stateMtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = ssn.SetLaunch(ctx, &launch); err != nil {
+		return err
+	}
+	if mode == MODE_CORE {
+		if err = ssn.LoadCore(ctx, core); err != nil {
+			return err
+		}
+	}
+	for _, bp := range bps {
+		loc, opts := bp.Location(), bp.Opts()
+		if len(loc) == 0 || opts == nil {
+			continue
+		}
+		if _, err = ssn.bkpts.Insert(ctx, loc, opts); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,304 @@
+package gdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A stand-in for gdb --interpreter=mi2. It answers commands with ^done,
+// evaluates an expression to itself, keeps a breakpoint table, fails
+// -boom with an ^error and exits with 3 on die.
+const fakeGdb = `#!/bin/sh
+n=0
+bps=""
+bkpt() {
+	printf 'bkpt={number="%s",type="breakpoint",disp="keep",enabled="y",addr="0x0000000000401000",func="main.main",file="main.go",fullname="/src/main.go",line="%s",times="0",original-location="main.go:%s"}' $1 $1 $1
+}
+echo "(gdb)"
+while IFS= read -r line; do
+	tok=${line%%[!0-9]*}
+	cmd=${line#$tok}
+	case "$cmd" in
+	-data-evaluate-expression\ *)
+		echo "$tok^done,value=${cmd#-data-evaluate-expression }" ;;
+	-break-insert*)
+		n=$((n+1))
+		bps="$bps $n"
+		echo "$tok^done,$(bkpt $n)" ;;
+	-break-delete\ *)
+		left=""
+		for b in $bps; do
+			case " ${cmd#-break-delete } " in
+			*" $b "*) ;;
+			*) left="$left $b" ;;
+			esac
+		done
+		bps=$left
+		echo "$tok^done" ;;
+	-break-list)
+		body=""
+		for b in $bps; do
+			body="$body${body:+,}$(bkpt $b)"
+		done
+		echo "$tok^done,BreakpointTable={nr_rows=\"0\",nr_cols=\"6\",hdr=[],body=[$body]}" ;;
+	-boom)
+		echo "$tok^error,msg=\"boom\"" ;;
+	die)
+		exit 3 ;;
+	*)
+		echo "$tok^done" ;;
+	esac
+	echo "(gdb)"
+done
+`
+
+// Starts a session on fakeGdb, it is closed when the test ends.
+func startFakeGdb(t *testing.T) *Ssn {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "gdb")
+	if err := ioutil.WriteFile(bin, []byte(fakeGdb), 0755); err != nil {
+		t.Fatal(err)
+	}
+	GdbBinPath = bin
+	ssn := NewSsn("", make(chan error, 10))
+	if err := ssn.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ssn.Close)
+	return ssn
+}
+
+func testCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestQuote(t *testing.T) {
+
+	tests := []struct {
+		in, want string
+	}{
+		{``, `""`},
+		{`main.go`, `"main.go"`},
+		{`a "b"`, `"a \"b\""`},
+		{`C:\dir`, `"C:\\dir"`},
+		{"x\ny\rz", `"x\ny\rz"`},
+	}
+	for _, tt := range tests {
+		if got := quote(tt.in); got != tt.want {
+			t.Errorf("quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteArgs(t *testing.T) {
+
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{nil, ``},
+		{[]string{"a"}, `'a'`},
+		{[]string{"a b", ""}, `'a b' ''`},
+		{[]string{"it's"}, `'it'\''s'`},
+		{[]string{"$HOME", "`id`", "; rm -rf /"}, "'$HOME' '`id`' '; rm -rf /'"},
+	}
+	for _, tt := range tests {
+		got, err := quoteArgs(tt.in)
+		if err != nil {
+			t.Errorf("quoteArgs(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("quoteArgs(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{{"a\n-gdb-exit"}, {"ok", "b\r"}} {
+		if _, err := quoteArgs(args); !errors.Is(err, ErrMultiline) {
+			t.Errorf("quoteArgs(%q): got %v, want ErrMultiline", args, err)
+		}
+	}
+}
+
+func TestSendRawRejectsTokens(t *testing.T) {
+
+	ssn := NewSsn("", nil)
+	for _, cmd := range []string{"5-exec-run", "  12-data-evaluate-expression x", "-list-features\n7-exec-run"} {
+		if err := ssn.SendRaw(context.Background(), cmd); err != ErrTokenReserved {
+			t.Errorf("SendRaw(%q): got %v, want ErrTokenReserved", cmd, err)
+		}
+	}
+}
+
+func TestGetResponseRoutesByToken(t *testing.T) {
+
+	ssn := startFakeGdb(t)
+	ctx := testCtx(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			want := strconv.Itoa(i)
+			got, err := ssn.Evaluate(ctx, want)
+			if err == nil && got != want {
+				err = fmt.Errorf("Evaluate(%s) = %s", want, got)
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var me *MIError
+	if _, _, err := ssn.GetResponseContext(ctx, "-boom"); !errors.As(err, &me) || me.Msg != "boom" {
+		t.Errorf("-boom: got %v, want an *MIError", err)
+	}
+
+	// the result of a command without a token goes to GdbOutput
+	if err := ssn.SendRaw(ctx, `-data-evaluate-expression "raw"`); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case m := <-ssn.GdbOutput():
+			for _, r := range m.Records {
+				if r.Nature == NATURE_RESULT && str(r.Data, "value") == "raw" {
+					return
+				}
+			}
+		case <-ctx.Done():
+			t.Fatal("the raw result never reached GdbOutput")
+		}
+	}
+}
+
+func TestRunBeforeStart(t *testing.T) {
+
+	// must not touch the context the session doesn't have yet
+	NewSsn("", nil).Run()
+}
+
+func TestRestart(t *testing.T) {
+
+	ssn := startFakeGdb(t)
+	ctx := testCtx(t)
+	exits := ssn.Subscribe([]byte{NATURE_NOTIFY}, "gdb-exited")
+
+	if _, err := ssn.Breakpoints().Insert(ctx, "main.go:1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssn.LoadCore(ctx, "/tmp/core"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := ssn.Restart(ctx); err != nil {
+			t.Fatalf("restart %d: %v", i, err)
+		}
+		if ssn.IsKilled() || !ssn.IsStarted() {
+			t.Fatalf("restart %d: killed %v, started %v", i, ssn.IsKilled(), ssn.IsStarted())
+		}
+		if got := ssn.Target().Mode; got != MODE_CORE {
+			t.Errorf("restart %d: mode %v, want the core file", i, got)
+		}
+		if got := len(ssn.Breakpoints().List()); got != 1 {
+			t.Errorf("restart %d: %d breakpoints, want 1", i, got)
+		}
+		if _, err := ssn.Evaluate(ctx, "1"); err != nil {
+			t.Fatalf("restart %d: %v", i, err)
+		}
+	}
+
+	// the GDBs that were replaced don't count as the session's GDB exiting
+	select {
+	case r := <-exits.C:
+		t.Fatalf("got %v after a restart", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if ssn.IsKilled() {
+		t.Fatal("killed after a restart")
+	}
+
+	// the current one does
+	if err := ssn.SendRaw(ctx, "die"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-exits.C:
+		if ex, err := DecodeGdbExit(r); err != nil || ex.ExitCode != 3 {
+			t.Errorf("gdb-exited: %+v, %v", ex, err)
+		}
+	case <-ctx.Done():
+		t.Fatal("no gdb-exited")
+	}
+	if !ssn.IsKilled() {
+		t.Error("not killed after the GDB exited")
+	}
+
+	// an exited GDB can be restarted, an attached target can't
+	if err := ssn.Restart(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssn.Attach(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssn.Restart(ctx); err != ErrCantRestart {
+		t.Errorf("restart of an attached target: got %v, want ErrCantRestart", err)
+	}
+}
+
+func TestFailedStart(t *testing.T) {
+
+	defer func(p string) { GdbBinPath = p }(GdbBinPath)
+	GdbBinPath = filepath.Join(t.TempDir(), "no-gdb")
+	ssn := NewSsn("", make(chan error, 10))
+	defer ssn.Close()
+	if err := ssn.Start(""); err == nil {
+		t.Fatal("started without a gdb")
+	}
+	if ssn.IsStarted() || ssn.IsKilled() {
+		t.Fatalf("started %v, killed %v after a failed start", ssn.IsStarted(), ssn.IsKilled())
+	}
+
+	// nothing waits on the GDB that didn't start
+	ctx := testCtx(t)
+	if _, _, err := ssn.GetResponseContext(ctx, "-list-features"); err != ErrNotStarted {
+		t.Errorf("GetResponseContext: got %v, want ErrNotStarted", err)
+	}
+	if err := ssn.SendRaw(ctx, "-list-features"); err != ErrNotStarted {
+		t.Errorf("SendRaw: got %v, want ErrNotStarted", err)
+	}
+	if err := ssn.SendInferior(ctx, "x"); err != ErrNotStarted {
+		t.Errorf("SendInferior: got %v, want ErrNotStarted", err)
+	}
+	if err := ssn.Restart(ctx); err != ErrNotStarted {
+		t.Errorf("Restart: got %v, want ErrNotStarted", err)
+	}
+
+	// and it can be started once there is one
+	fake := startFakeGdb(t)
+	fake.Close()
+	if err := ssn.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssn.Evaluate(ctx, "1"); err != nil {
+		t.Error(err)
+	}
+}
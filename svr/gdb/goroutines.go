@@ -0,0 +1,119 @@
+package gdb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A goroutine as listed by the 'info goroutines' command of the Go
+// runtime support script. Frame is the top of Stack when the stack is
+// collected, StackError is set when it couldn't be.
+type Goroutine struct {
+	Id         int      `json:"id"`
+	Current    bool     `json:"current"`
+	Status     string   `json:"status"`
+	Func       string   `json:"func"`
+	Frame      *Frame   `json:"frame,omitempty"`
+	Stack      []*Frame `json:"stack,omitempty"`
+	StackError string   `json:"stack-error,omitempty"`
+}
+
+//	* 1 running  runtime.systemstack_switch
+//	  17 waiting  runtime.gopark
+var goroutineLine = regexp.MustCompile(`^\s*(\*)?\s*(\d+)\s+(\S+)\s+(.*?)\s*$`)
+
+//	#0  runtime.gopark (unlockf=...) at /usr/local/go/src/runtime/proc.go:398
+//	#1  0x000000000043ba2e in runtime.chanrecv (c=...) at /usr/local/go/src/runtime/chan.go:583
+var backtraceLine = regexp.MustCompile(`^#(\d+)\s+(?:(0x[0-9a-fA-F]+) in )?(\S+)(?: \(.*\))?(?: at (.+):(\d+)| from (\S+))?\s*$`)
+
+// Runs a CLI command and returns its console output.
+func (ssn *Ssn) Console(ctx context.Context, cmd string) (string, error) {
+
+	_, resp, err := ssn.GetResponseContext(ctx, "-interpreter-exec console "+quote(cmd))
+	if err != nil {
+		return "", err
+	}
+	out := make([]string, 0, len(resp.Records))
+	for _, r := range resp.Records {
+		if r.Nature == NATURE_CONSOLE_STRM {
+			out = append(out, unescape(r.Stream))
+		}
+	}
+	return strings.Join(out, ""), nil
+}
+
+// Lists the goroutines of a stopped Go program and, when withStacks is
+// set, the backtrace of each. Relies on the runtime-gdb.py script
+// sourced on Start.
+func (ssn *Ssn) GetGoroutines(ctx context.Context, withStacks bool) ([]*Goroutine, error) {
+
+	out, err := ssn.Console(ctx, "info goroutines")
+	if err != nil {
+		return nil, err
+	}
+	grs := ParseGoroutines(out)
+	if !withStacks {
+		return grs, nil
+	}
+	for _, g := range grs {
+		bt, err := ssn.Console(ctx, fmt.Sprintf("goroutine %d bt", g.Id))
+		if err != nil {
+			if ctx.Err() != nil {
+				return grs, err
+			}
+			g.StackError = err.Error()
+			continue
+		}
+		g.Stack = ParseBacktrace(bt)
+		if len(g.Stack) > 0 {
+			g.Frame = g.Stack[0]
+		}
+	}
+	return grs, nil
+}
+
+// Parses the output of 'info goroutines', lines that don't look like
+// a goroutine are skipped.
+func ParseGoroutines(s string) []*Goroutine {
+
+	grs := make([]*Goroutine, 0)
+	for _, line := range strings.Split(s, "\n") {
+		m := goroutineLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[2])
+		grs = append(grs, &Goroutine{
+			Id:      id,
+			Current: m[1] == "*",
+			Status:  m[3],
+			Func:    m[4],
+		})
+	}
+	return grs
+}
+
+// Parses the output of a CLI backtrace into frames. Lines that don't
+// start a frame are skipped.
+func ParseBacktrace(s string) []*Frame {
+
+	frames := make([]*Frame, 0)
+	for _, line := range strings.Split(s, "\n") {
+		m := backtraceLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		f := &Frame{Func: m[3], File: m[4], From: m[6]}
+		f.Level, _ = strconv.Atoi(m[1])
+		f.Line, _ = strconv.Atoi(m[5])
+		if len(m[2]) > 0 {
+			addr, _ := strconv.ParseUint(m[2][2:], 16, 64)
+			f.Addr = Addr(addr)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
@@ -0,0 +1,44 @@
+package gdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGoroutines(t *testing.T) {
+
+	out := "* 1 running  runtime.systemstack_switch\n" +
+		"  2 waiting  runtime.gopark\n" +
+		"  17 syscall  syscall.Syscall6\n" +
+		"warning: something unrelated\n" +
+		"\n"
+	want := []*Goroutine{
+		{Id: 1, Current: true, Status: "running", Func: "runtime.systemstack_switch"},
+		{Id: 2, Status: "waiting", Func: "runtime.gopark"},
+		{Id: 17, Status: "syscall", Func: "syscall.Syscall6"},
+	}
+	got := ParseGoroutines(out)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+	if got := ParseGoroutines(""); len(got) != 0 {
+		t.Errorf("empty output: got %v", got)
+	}
+}
+
+func TestParseBacktrace(t *testing.T) {
+
+	out := "#0  runtime.gopark (unlockf=0x0, lock=0x0) at /usr/local/go/src/runtime/proc.go:398\n" +
+		"#1  0x000000000043ba2e in runtime.chanrecv (c=0xc000020060) at /usr/local/go/src/runtime/chan.go:583\n" +
+		"#2  0x00007ffff7a2d830 in __libc_start_main () from /lib/x86_64-linux-gnu/libc.so.6\n" +
+		"(More stack frames follow...)\n"
+	want := []*Frame{
+		{Level: 0, Func: "runtime.gopark", File: "/usr/local/go/src/runtime/proc.go", Line: 398},
+		{Level: 1, Addr: 0x43ba2e, Func: "runtime.chanrecv", File: "/usr/local/go/src/runtime/chan.go", Line: 583},
+		{Level: 2, Addr: 0x7ffff7a2d830, Func: "__libc_start_main", From: "/lib/x86_64-linux-gnu/libc.so.6"},
+	}
+	got := ParseBacktrace(out)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package gdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How the program being debugged is started. Env holds overrides of
+// the environment the program inherits from the GDB, Dir is the working
+// directory and is left alone when empty.
+type Launch struct {
+	Args []string          `json:"args,omitempty"`
+	Env  map[string]string `json:"env,omitempty"`
+	Dir  string            `json:"cwd,omitempty"`
+}
+
+// Sets the args, environment and working directory of l for the next
+// run. Nil Args leave the current arguments alone.
+func (ssn *Ssn) SetLaunch(ctx context.Context, l *Launch) error {
+
+	if l.Args != nil {
+		if err := ssn.SetArgs(ctx, l.Args); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(l.Env))
+	for name := range l.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ssn.SetEnv(ctx, name, l.Env[name]); err != nil {
+			return err
+		}
+	}
+	if len(l.Dir) > 0 {
+		return ssn.SetDir(ctx, l.Dir)
+	}
+	return nil
+}
+
+// Sets a variable in the environment of the program, the GDB's own
+// environment is not changed.
+func (ssn *Ssn) SetEnv(ctx context.Context, name, value string) error {
+	if len(name) == 0 || strings.ContainsAny(name, "= \t\r\n") {
+		return fmt.Errorf("gdb: invalid environment variable name: %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("gdb: environment variable %s: %w", name, ErrMultiline)
+	}
+	// -gdb-set hands the rest of the line to the CLI 'set' unparsed
+	if _, _, err := ssn.GetResponseContext(ctx, "-gdb-set environment "+name+"="+value); err != nil {
+		return err
+	}
+	ssn.stateMtx.Lock()
+	if ssn.launch.Env == nil {
+		ssn.launch.Env = make(map[string]string)
+	}
+	ssn.launch.Env[name] = value
+	ssn.stateMtx.Unlock()
+	return nil
+}
+
+// Sets the working directory of the GDB, which the program inherits
+// when it is run.
+func (ssn *Ssn) SetDir(ctx context.Context, dir string) error {
+	if _, _, err := ssn.GetResponseContext(ctx, "-environment-cd "+quote(dir)); err != nil {
+		return err
+	}
+	ssn.stateMtx.Lock()
+	ssn.launch.Dir = dir
+	ssn.stateMtx.Unlock()
+	return nil
+}
+
+// Applies l, when given, and runs the program. Returns once the GDB
+// reports it is running.
+func (ssn *Ssn) RunContext(ctx context.Context, l *Launch) error {
+	if ssn.Target().Mode == MODE_CORE {
+		return ErrCoreTarget
+	}
+	if l != nil {
+		if err := ssn.SetLaunch(ctx, l); err != nil {
+			return err
+		}
+	}
+	if _, _, err := ssn.GetResponseContext(ctx, "-exec-run"); err != nil {
+		return err
+	}
+	ssn.target.update(func(t *Target) {
+		t.Mode = MODE_LAUNCH
+	})
+	return nil
+}
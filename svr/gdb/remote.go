@@ -0,0 +1,162 @@
+package gdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/cmn"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// The gdbserver binary used by StartGdbServer, looked up on the PATH by
+// Discover when empty. Remote debugging works without it, the GDB can
+// connect to a gdbserver started elsewhere, e.g. in a container.
+var GdbServerPath string
+
+var ErrNoGdbServer = errors.New("gdb: no gdbserver found")
+
+var ErrBadAddr = errors.New("gdb: invalid gdbserver address, expected host:port")
+
+// Connects to a gdbserver at addr, host:port. With extended the
+// connection stays up after the program exits and the program can be
+// run again.
+func (ssn *Ssn) Connect(ctx context.Context, addr string, extended bool) error {
+	if err := checkAddr(addr); err != nil {
+		return err
+	}
+	target := "remote"
+	if extended {
+		target = "extended-remote"
+	}
+	if _, _, err := ssn.GetResponseContext(ctx, "-target-select "+target+" "+addr); err != nil {
+		return err
+	}
+	ssn.target.update(func(t *Target) {
+		t.Mode = MODE_REMOTE
+		t.State = STATE_STOPPED
+	})
+	return nil
+}
+
+// Checks addr is a host:port, it is put in the -target-select command as
+// is so it must not carry anything else.
+func checkAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrBadAddr, addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%w: invalid port %q", ErrBadAddr, port)
+	}
+	if strings.ContainsAny(host, " \t\r\n\"'\\") {
+		return fmt.Errorf("%w: invalid host %q", ErrBadAddr, host)
+	}
+	return nil
+}
+
+// Starts a gdbserver on a free local port with the program exe, which it
+// starts stopped at its first instruction, and returns the address to
+// Connect to. The gdbserver is killed with the session, the output of
+// the program goes to InferiorOutput. The program's stdin is not
+// connected.
+func (ssn *Ssn) StartGdbServer(ctx context.Context, exe string, args ...string) (string, error) {
+
+	if len(GdbServerPath) == 0 {
+		return "", ErrNoGdbServer
+	}
+	addr, err := freeLocalAddr()
+	if err != nil {
+		return "", err
+	}
+
+	ssn.stateMtx.Lock()
+	if !ssn.started || ssn.killed {
+		ssn.stateMtx.Unlock()
+		return "", ErrNotStarted
+	}
+	if ssn.server != nil {
+		ssn.stateMtx.Unlock()
+		return "", fmt.Errorf("gdb: gdbserver: %w", ErrIsStarted)
+	}
+	argv := append([]string{addr, exe}, args...)
+	server := cmn.NewCmdWrapper(exec.Command(GdbServerPath, argv...))
+	if err = server.StartContext(ssn.ctx); err != nil {
+		ssn.stateMtx.Unlock()
+		return "", err
+	}
+	ssn.server = server
+	done := ssn.ctx.Done()
+	ssn.stateMtx.Unlock()
+
+	// a gdbserver that never listened is dropped so another can be started
+	fail := func(err error) (string, error) {
+		server.Kill()
+		ssn.stateMtx.Lock()
+		if ssn.server == server {
+			ssn.server = nil
+		}
+		ssn.stateMtx.Unlock()
+		return "", err
+	}
+
+	// gdbserver reports on stderr once it accepts connections
+	for {
+		select {
+		case m := <-server.ErrChan():
+			if m.Err != nil {
+				return fail(fmt.Errorf("gdb: gdbserver ended before listening: %v", m.Err))
+			}
+			if strings.HasPrefix(m.Msg, "Listening on port") {
+				go ssn.forwardServerOutput(server, done)
+				return addr, nil
+			}
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		}
+	}
+}
+
+// Passes what the gdbserver and the program it runs write to
+// InferiorOutput.
+func (ssn *Ssn) forwardServerOutput(server *cmn.CmdWrapper, done <-chan struct{}) {
+
+	out, errOut := server.OutChan(), server.ErrChan()
+	for out != nil || errOut != nil {
+		var m *cmn.CmdMsg
+		select {
+		case m = <-out:
+			if m.Err != nil {
+				out = nil
+			}
+		case m = <-errOut:
+			if m.Err != nil {
+				errOut = nil
+			}
+		case <-done:
+			return
+		}
+		if len(m.Msg) == 0 {
+			continue
+		}
+		select {
+		case ssn.inferiorOutput <- m.Msg:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Returns a local address with a port nothing is listening on. Another
+// process may take the port before it is used but it's unlikely.
+func freeLocalAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr, nil
+}
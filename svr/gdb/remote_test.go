@@ -0,0 +1,61 @@
+package gdb
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckAddr(t *testing.T) {
+
+	for _, addr := range []string{"localhost:1234", ":1234", "10.0.0.2:2345", "[::1]:1234"} {
+		if err := checkAddr(addr); err != nil {
+			t.Errorf("checkAddr(%q): %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"", "localhost", "host:0", "host:http", "host:1234\n-gdb-exit", "a b:1234", "host:1234 extra"} {
+		if err := checkAddr(addr); !errors.Is(err, ErrBadAddr) {
+			t.Errorf("checkAddr(%q): got %v, want ErrBadAddr", addr, err)
+		}
+	}
+}
+
+func TestStartGdbServerFailures(t *testing.T) {
+
+	ssn := startFakeGdb(t)
+	ctx := testCtx(t)
+	dir := t.TempDir()
+	script := func(name, body string) string {
+		bin := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(bin, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return bin
+	}
+	defer func(p string) { GdbServerPath = p }(GdbServerPath)
+
+	GdbServerPath = script("fails", "echo 'cannot run' >&2; exit 1")
+	for i := 0; i < 2; i++ {
+		if _, err := ssn.StartGdbServer(ctx, "/bin/true"); err == nil || errors.Is(err, ErrIsStarted) {
+			t.Fatalf("attempt %d: got %v, want the gdbserver's failure", i, err)
+		}
+	}
+
+	GdbServerPath = script("hangs", "exec sleep 10")
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := ssn.StartGdbServer(short, "/bin/true"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+
+	GdbServerPath = script("listens", "echo 'Listening on port' >&2; exec sleep 10")
+	if _, err := ssn.StartGdbServer(ctx, "/bin/true"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssn.StartGdbServer(ctx, "/bin/true"); !errors.Is(err, ErrIsStarted) {
+		t.Errorf("second gdbserver: got %v, want ErrIsStarted", err)
+	}
+}
@@ -0,0 +1,178 @@
+package gdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// How the program being debugged came to be.
+const (
+	MODE_NONE   = "none"
+	MODE_LAUNCH = "launch"
+	MODE_ATTACH = "attach"
+	MODE_CORE   = "core"
+	MODE_REMOTE = "remote"
+)
+
+// Returned by the commands that run the program when the target is a
+// core file.
+var ErrCoreTarget = errors.New("gdb: the target is a core file, it can't be run")
+
+// The state of the program being debugged.
+const (
+	STATE_IDLE    = "idle"
+	STATE_RUNNING = "running"
+	STATE_STOPPED = "stopped"
+)
+
+// What the GDB is debugging. Pid is 0 when there is no process.
+type Target struct {
+	Mode  string `json:"mode"`
+	Pid   int    `json:"pid,omitempty"`
+	State string `json:"state"`
+}
+
+// Keeps the Target current from the *running, *stopped and
+// =thread-group-started / =thread-group-exited records, and publishes
+// a =target-changed record, see DecodeTarget, after each change.
+type targetTracker struct {
+	ssn *Ssn
+	mtx *sync.Mutex
+	t   Target
+}
+
+func newTargetTracker(ssn *Ssn) *targetTracker {
+	tt := &targetTracker{ssn, &sync.Mutex{}, Target{MODE_NONE, 0, STATE_IDLE}}
+	sub := ssn.Subscribe([]byte{NATURE_EXEC_OUT, NATURE_NOTIFY}, "running", "stopped", "thread-group-started", "thread-group-exited")
+	go tt.track(sub)
+	return tt
+}
+
+func (tt *targetTracker) track(sub *Subscription) {
+	for r := range sub.C {
+		tt.update(func(t *Target) {
+			switch r.Class {
+			case "running":
+				t.State = STATE_RUNNING
+			case "stopped":
+				t.State = STATE_STOPPED
+				if ev, err := DecodeStoppedEvent(r); err == nil && IsExitReason(ev.Reason) {
+					t.State = STATE_IDLE
+				}
+			case "thread-group-started":
+				t.Pid, _ = strconv.Atoi(str(r.Data, "pid"))
+			case "thread-group-exited":
+				t.Pid = 0
+				t.State = STATE_IDLE
+				if t.Mode == MODE_ATTACH {
+					t.Mode = MODE_NONE
+				}
+			}
+		})
+	}
+}
+
+// Applies f to the target and publishes the result if it changed.
+func (tt *targetTracker) update(f func(t *Target)) {
+	tt.mtx.Lock()
+	prev := tt.t
+	f(&tt.t)
+	t := tt.t
+	tt.mtx.Unlock()
+	if t == prev {
+		return
+	}
+	tt.ssn.events.publish([]*Record{{
+		Nature: NATURE_NOTIFY,
+		Class:  "target-changed",
+		Data: map[string]interface{}{
+			"mode":  t.Mode,
+			"pid":   strconv.Itoa(t.Pid),
+			"state": t.State,
+		},
+	}})
+}
+
+// Back to nothing being debugged when the GDB is restarted.
+func (tt *targetTracker) reset() {
+	tt.update(func(t *Target) {
+		*t = Target{MODE_NONE, 0, STATE_IDLE}
+	})
+}
+
+func (tt *targetTracker) get() Target {
+	tt.mtx.Lock()
+	defer tt.mtx.Unlock()
+	return tt.t
+}
+
+// Returns true for the *stopped reasons that mean the program ended.
+func IsExitReason(reason string) bool {
+	return reason == "exited" || reason == "exited-normally" || reason == "exited-signalled"
+}
+
+// Returns what the GDB is debugging.
+func (ssn *Ssn) Target() Target {
+	return ssn.target.get()
+}
+
+// Decodes the =target-changed record published by a Ssn when the mode,
+// process or state of its target changes. This record is not part of
+// the MI, it is made up by the Ssn.
+func DecodeTarget(r *Record) (*Target, error) {
+	if r.Nature != NATURE_NOTIFY || r.Class != "target-changed" {
+		return nil, fmt.Errorf("gdb: not a target-changed record: %c%s", r.Nature, r.Class)
+	}
+	t := &Target{Mode: str(r.Data, "mode"), State: str(r.Data, "state")}
+	var err error
+	if t.Pid, err = optInt(r.Data, "pid"); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Attaches to the running process pid. The program is stopped once
+// attached.
+func (ssn *Ssn) Attach(ctx context.Context, pid int) error {
+	if _, _, err := ssn.GetResponseContext(ctx, "-target-attach "+strconv.Itoa(pid)); err != nil {
+		return err
+	}
+	ssn.target.update(func(t *Target) {
+		t.Mode = MODE_ATTACH
+		t.Pid = pid
+	})
+	return nil
+}
+
+// Loads a core file for post-mortem debugging. The executable that
+// dumped it must be the one the GDB was started with. From then on the
+// program can be inspected but not run, see ErrCoreTarget.
+func (ssn *Ssn) LoadCore(ctx context.Context, core string) error {
+	if _, _, err := ssn.GetResponseContext(ctx, "-target-select core "+quote(core)); err != nil {
+		return err
+	}
+	ssn.stateMtx.Lock()
+	ssn.core = core
+	ssn.stateMtx.Unlock()
+	ssn.target.update(func(t *Target) {
+		t.Mode = MODE_CORE
+		t.State = STATE_STOPPED
+	})
+	return nil
+}
+
+// Detaches from the attached process, which keeps running.
+func (ssn *Ssn) Detach(ctx context.Context) error {
+	if _, _, err := ssn.GetResponseContext(ctx, "-target-detach"); err != nil {
+		return err
+	}
+	ssn.target.update(func(t *Target) {
+		t.Mode = MODE_NONE
+		t.Pid = 0
+		t.State = STATE_IDLE
+	})
+	return nil
+}
@@ -0,0 +1,236 @@
+package gdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An MI variable object. The value of a struct, slice or map is only
+// a summary, its fields or elements are child variable objects listed
+// on demand with VarObjs.ListChildren.
+type VarObj struct {
+	Name     string `json:"name"`
+	Exp      string `json:"exp"`
+	Value    string `json:"value,omitempty"`
+	Type     string `json:"type,omitempty"`
+	NumChild int    `json:"numchild"`
+	ThreadId string `json:"thread-id,omitempty"`
+	Dynamic  bool   `json:"dynamic,omitempty"`
+	HasMore  bool   `json:"has_more,omitempty"`
+}
+
+// A change to a variable object reported by -var-update. InScope is
+// "true", "false" or "invalid", an invalid object has been deleted.
+type VarChange struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	InScope     string `json:"in_scope"`
+	TypeChanged bool   `json:"type_changed,omitempty"`
+	NewType     string `json:"new_type,omitempty"`
+	NewNumChild int    `json:"new_num_children,omitempty"`
+}
+
+// The variable objects created in a session, including the children
+// that have been listed.
+type VarObjs struct {
+	ssn  *Ssn
+	mtx  *sync.Mutex
+	objs map[string]*VarObj
+}
+
+func newVarObjs(ssn *Ssn) *VarObjs {
+	return &VarObjs{ssn, &sync.Mutex{}, make(map[string]*VarObj)}
+}
+
+// Forgets every variable object, they die with the GDB.
+func (v *VarObjs) reset() {
+	v.mtx.Lock()
+	v.objs = make(map[string]*VarObj)
+	v.mtx.Unlock()
+}
+
+// Creates a variable object for expr in the given thread and frame, or
+// in the current frame when threadId is empty.
+func (v *VarObjs) Create(ctx context.Context, expr, threadId string, frameLvl int) (*VarObj, error) {
+
+	cmd := "-var-create"
+	if len(threadId) > 0 {
+		if err := checkThreadId(threadId); err != nil {
+			return nil, err
+		}
+		cmd += fmt.Sprintf(" --thread %s --frame %d", threadId, frameLvl)
+	}
+	cmd += " - * " + quote(expr)
+
+	i, resp, err := v.ssn.GetResponseContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := decodeVarObj(resp.Records[i].Data)
+	if err != nil {
+		return nil, err
+	}
+	obj.Exp = expr
+	v.set(obj)
+	return obj, nil
+}
+
+// Lists the children of a variable object with their values.
+func (v *VarObjs) ListChildren(ctx context.Context, name string) ([]*VarObj, error) {
+
+	i, resp, err := v.ssn.GetResponseContext(ctx, "-var-list-children --all-values "+quote(name))
+	if err != nil {
+		return nil, err
+	}
+	children := make([]*VarObj, 0)
+	if _, ok := resp.Records[i].Data["children"]; !ok {
+		return children, nil
+	}
+	list, err := listOf("children", resp.Records[i].Data["children"])
+	if err != nil {
+		return nil, err
+	}
+	for _, elm := range list {
+		t, err := tupleOf("child", elm)
+		if err != nil {
+			return children, err
+		}
+		obj, err := decodeVarObj(t)
+		if err != nil {
+			return children, err
+		}
+		children = append(children, obj)
+	}
+	v.set(children...)
+	return children, nil
+}
+
+// Asks the GDB which variable objects changed since the last update,
+// typically called after each stop. Invalid objects are forgotten.
+func (v *VarObjs) Update(ctx context.Context) ([]*VarChange, error) {
+
+	v.mtx.Lock()
+	empty := len(v.objs) == 0
+	v.mtx.Unlock()
+	if empty {
+		return nil, nil
+	}
+
+	i, resp, err := v.ssn.GetResponseContext(ctx, "-var-update --all-values *")
+	if err != nil {
+		return nil, err
+	}
+	list, err := listOf("changelist", resp.Records[i].Data["changelist"])
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*VarChange, 0, len(list))
+	for _, elm := range list {
+		t, err := tupleOf("change", elm)
+		if err != nil {
+			return changes, err
+		}
+		c := &VarChange{
+			Name:        str(t, "name"),
+			Value:       str(t, "value"),
+			InScope:     str(t, "in_scope"),
+			TypeChanged: str(t, "type_changed") == "true",
+			NewType:     str(t, "new_type"),
+		}
+		if c.NewNumChild, err = optInt(t, "new_num_children"); err != nil {
+			return changes, err
+		}
+		changes = append(changes, c)
+	}
+
+	v.mtx.Lock()
+	for _, c := range changes {
+		obj, ok := v.objs[c.Name]
+		if !ok {
+			continue
+		}
+		switch {
+		case c.InScope == "invalid":
+			v.forget(c.Name)
+		case c.TypeChanged:
+			// the children are deleted along with the old type
+			v.forget(c.Name)
+			obj.Value, obj.Type, obj.NumChild = c.Value, c.NewType, c.NewNumChild
+			v.objs[c.Name] = obj
+		default:
+			obj.Value = c.Value
+		}
+	}
+	v.mtx.Unlock()
+	return changes, nil
+}
+
+// Deletes a variable object and its children.
+func (v *VarObjs) Delete(ctx context.Context, name string) error {
+	if _, _, err := v.ssn.GetResponseContext(ctx, "-var-delete "+quote(name)); err != nil {
+		return err
+	}
+	v.mtx.Lock()
+	v.forget(name)
+	v.mtx.Unlock()
+	return nil
+}
+
+// Returns copies of the known variable objects ordered by name, so
+// children follow their parent.
+func (v *VarObjs) List() []*VarObj {
+	v.mtx.Lock()
+	list := make([]*VarObj, 0, len(v.objs))
+	for _, obj := range v.objs {
+		cp := *obj
+		list = append(list, &cp)
+	}
+	v.mtx.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func (v *VarObjs) set(objs ...*VarObj) {
+	v.mtx.Lock()
+	for _, obj := range objs {
+		v.objs[obj.Name] = obj
+	}
+	v.mtx.Unlock()
+}
+
+// Removes name and its children, which are named name.child. Call with
+// mtx held.
+func (v *VarObjs) forget(name string) {
+	for n := range v.objs {
+		if n == name || strings.HasPrefix(n, name+".") {
+			delete(v.objs, n)
+		}
+	}
+}
+
+func decodeVarObj(t map[string]interface{}) (*VarObj, error) {
+
+	obj := &VarObj{
+		Name:     str(t, "name"),
+		Exp:      str(t, "exp"),
+		Value:    str(t, "value"),
+		Type:     str(t, "type"),
+		ThreadId: str(t, "thread-id"),
+		Dynamic:  str(t, "dynamic") == "1",
+		HasMore:  str(t, "has_more") == "1",
+	}
+	if len(obj.Name) == 0 {
+		return nil, fmt.Errorf("gdb: variable object without name: %v", t)
+	}
+	var err error
+	if obj.NumChild, err = optInt(t, "numchild"); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
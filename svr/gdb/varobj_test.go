@@ -0,0 +1,20 @@
+package gdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestThreadIdIsChecked(t *testing.T) {
+
+	ssn := startFakeGdb(t)
+	ctx := testCtx(t)
+	for _, id := range []string{"1 --frame 0 - * x\n-gdb-exit", "x", "-1"} {
+		if _, err := ssn.VarObjs().Create(ctx, "x", id, 0); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("Create with thread %q: got %v, want ErrBadNumber", id, err)
+		}
+		if _, err := ssn.GetFrameVarsContext(ctx, id, 0); !errors.Is(err, ErrBadNumber) {
+			t.Errorf("GetFrameVarsContext(%q): got %v, want ErrBadNumber", id, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package svr
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How long a session waits for a client to reconnect after its
+// websocket is gone before it ends.
+var reconnectGrace = time.Minute
+
+// The running sessions by token.
+var (
+	ssnsMtx = &sync.Mutex{}
+	ssns    = make(map[string]*nvlvSsn)
+)
+
+func newSsnToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func registerSsn(ssn *nvlvSsn) {
+	ssnsMtx.Lock()
+	ssns[ssn.token] = ssn
+	ssnsMtx.Unlock()
+}
+
+func unregisterSsn(ssn *nvlvSsn) {
+	ssnsMtx.Lock()
+	delete(ssns, ssn.token)
+	ssnsMtx.Unlock()
+}
+
+// Returns the session with the token, or nil.
+func lookupSsn(token string) *nvlvSsn {
+	if len(token) == 0 {
+		return nil
+	}
+	ssnsMtx.Lock()
+	defer ssnsMtx.Unlock()
+	return ssns[token]
+}
+
+// Makes ws the client of the session, replacing the current one, if any.
+// Returns false if the session has ended.
+func (ssn *nvlvSsn) attach(ws *websocket.Conn) bool {
+	select {
+	case ssn.attachWs <- ws:
+		return true
+	case <-ssn.ctx.Done():
+		return false
+	}
+}
+
+// Lets the session know ws is gone.
+func (ssn *nvlvSsn) detach(ws *websocket.Conn) {
+	select {
+	case ssn.detachWs <- ws:
+	case <-ssn.ctx.Done():
+	}
+}
+
+// Called by the Run loop when a client connects. Takes the protocol
+// version from ?v=, tells the client the session token to reconnect
+// with, then replays the recent output and the current state of each
+// gdb session.
+func (ssn *nvlvSsn) onAttach(ws *websocket.Conn) {
+
+	if old := ssn.ws.conn; old != nil && old != ws {
+		old.Close()
+	}
+	ssn.ws.conn = ws
+	ssn.ws.version, _ = strconv.Atoi(ws.Request().URL.Query().Get("v"))
+	ssn.cmdMsgBody.send(ssn.ws, "ssn", ssn.token)
+	ssn.ws.replay()
+	ssn.cmdMsgBody.send(ssn.ws, "-ssn-list", ssn.targetList())
+	for _, t := range ssn.targets {
+		t.replay()
+	}
+}
+
+// Sends the state of the target: breakpoints, watches, and when the
+// program is stopped its threads.
+func (t *gdbTarget) replay() {
+
+	if !t.gdbSsn.IsStarted() || t.gdbSsn.IsKilled() {
+		return
+	}
+	if t.exe != nil {
+		t.cmdMsgBody.send(t.ssn.ws, "settings", t.exe)
+	}
+	t.cmdMsgBody.send(t.ssn.ws, "-bp-list", t.gdbSsn.Breakpoints().List())
+	t.cmdMsgBody.send(t.ssn.ws, "-watch-list", t.watches.values())
+	t.cmdMsgBody.send(t.ssn.ws, "-var-list", t.gdbSsn.VarObjs().List())
+	if t.gdbSsn.Target().State != gdb.STATE_STOPPED {
+		return
+	}
+	// the threads with their stacks and variables take a while
+	g := t.gdbSsn
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, threadsTimeout)
+		threads, err := getThreadsWithBt(ctx, g)
+		cancel()
+		if err != nil {
+			return
+		}
+		t.ssn.later(func() {
+			t.cmdMsgBody.send(t.ssn.ws, "-gdb-get-threads-frames", threads)
+		})
+	}()
+}
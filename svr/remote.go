@@ -0,0 +1,76 @@
+package svr
+
+import (
+	"context"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+)
+
+// Handles the admin commands for remote debugging:
+//
+//	-gdb-connect <host:port> [extended]
+//	-gdb-serve <exe> [args...]
+//
+// -gdb-connect connects to a gdbserver started elsewhere, an optional
+// "exe" gives the GDB the symbols of the program. -gdb-serve starts a
+// local gdbserver for exe and connects to it. Both reply with the
+// resulting target.
+func handleRemoteCmd(t *gdbTarget, adminCmd string, msg *clientBody) {
+
+	args := msg.args()
+	var connect func(ctx context.Context, g *gdb.Ssn) error
+	var exe string
+
+	switch adminCmd {
+
+	case "-gdb-connect":
+		if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "extended") {
+			t.cmdMsgBody.sendErr(t.ssn.ws, badRequest("argument error: expected host:port and optional 'extended'"), "cmd", adminCmd)
+			return
+		}
+		exe, _ = msg.Data["exe"].(string)
+		extended := len(args) == 2
+		connect = func(ctx context.Context, g *gdb.Ssn) error {
+			return g.Connect(ctx, args[0], extended)
+		}
+
+	case "-gdb-serve":
+		if len(args) == 0 {
+			t.cmdMsgBody.sendErr(t.ssn.ws, badRequest("argument error: no executable given"), "cmd", adminCmd)
+			return
+		}
+		exe = args[0]
+		connect = func(ctx context.Context, g *gdb.Ssn) error {
+			addr, err := g.StartGdbServer(ctx, exe, args[1:]...)
+			if err != nil {
+				return err
+			}
+			return g.Connect(ctx, addr, false)
+		}
+	}
+
+	if !t.gdbSsn.IsStarted() {
+		if err := t.gdbSsn.StartContext(t.ctx, exe); err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, fmt.Errorf("Err: Unable to start gdb ssn: %w", err), "cmd", adminCmd)
+			return
+		}
+	}
+
+	g := t.gdbSsn
+	req := t.ssn.ws.req
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+		err := connect(ctx, g)
+		cancel()
+		t.ssn.laterReply(req, func() {
+			if err != nil {
+				t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+				return
+			}
+			t.cmdMsgBody.send(t.ssn.ws, adminCmd, g.Target())
+			if len(exe) > 0 && t.exe == nil {
+				t.restoreExeSettings(exe, &gdb.Launch{})
+			}
+		})
+	}()
+}
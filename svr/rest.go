@@ -0,0 +1,401 @@
+package svr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The REST API, for scripts that would rather use curl than a websocket.
+// Sessions are the same as the websocket's, named by their token:
+//
+//	GET    /sessions
+//	POST   /sessions                          {exe, argv, env, cwd}
+//	GET    /sessions/{id}
+//	DELETE /sessions/{id}
+//	POST   /sessions/{id}/run                 {argv, env, cwd}
+//	GET    /sessions/{id}/threads
+//	GET    /sessions/{id}/breakpoints
+//	POST   /sessions/{id}/breakpoints         {location, condition, ...}
+//	DELETE /sessions/{id}/breakpoints/{number}
+//	POST   /sessions/{id}/exec/{command}      {args}
+//	GET    /sessions/{id}/events
+//
+// ?target=<id> picks a gdb session of the session, the current one
+// otherwise. The exec commands are those of execCmds without the
+// "-exec-" prefix and reply once the program stops. The events are a
+// Server-Sent Events stream, see sseHandler. Errors are sent as
+// {"error": {"code", "message"}} with the codes of the websocket
+// protocol. A session without a websocket ends once no request has been
+// in flight and no event stream open for reconnectGrace. With auth on a
+// session is only visible to the identity that created it.
+var RestPath string = "/sessions"
+
+var errSsnEnded = &protoError{codeNoSession, "the session has ended"}
+
+// A session as listed by the REST API.
+type ssnInfo struct {
+	Id       string        `json:"id"`
+	Attached bool          `json:"attached"`
+	Targets  []*targetInfo `json:"targets"`
+}
+
+func (ssn *nvlvSsn) info() *ssnInfo {
+	return &ssnInfo{ssn.token, ssn.ws.conn != nil, ssn.targetList()}
+}
+
+// Runs f on the Run loop and waits for it. Counts as the session being
+// used when no websocket is attached.
+func (ssn *nvlvSsn) do(f func()) error {
+	done := make(chan struct{})
+	ssn.later(func() {
+		f()
+		ssn.resetIdle()
+		close(done)
+	})
+	select {
+	case <-done:
+		return nil
+	case <-ssn.ctx.Done():
+		return errSsnEnded
+	}
+}
+
+// Keeps the session from ending while a request is in flight, e.g. an
+// exec command waiting for the program to stop. Undone by release.
+func (ssn *nvlvSsn) hold() error {
+	return ssn.do(func() { ssn.clients++ })
+}
+
+func (ssn *nvlvSsn) release() {
+	ssn.later(func() {
+		ssn.clients--
+		ssn.resetIdle()
+	})
+}
+
+func restHandler(w http.ResponseWriter, r *http.Request) {
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, RestPath), "/")
+	if len(path) == 0 {
+		switch r.Method {
+		case "GET":
+			restListSsns(w, r)
+		case "POST":
+			restCreateSsn(w, r)
+		default:
+			restMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	ssn := lookupSsn(parts[0])
+	if ssn == nil || !ssn.allows(identityOf(r)) {
+		restErr(w, &protoError{codeNoSession, "unknown session: " + parts[0]})
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			var info *ssnInfo
+			if err := ssn.do(func() { info = ssn.info() }); err != nil {
+				restErr(w, err)
+				return
+			}
+			restJson(w, http.StatusOK, info)
+		case "DELETE":
+			ssn.cancel()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			restMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	if r.Method != "GET" {
+		ssn.recordClient("rest "+r.Method+" "+r.URL.Path, r)
+	}
+	if parts[1] == "events" && len(parts) == 2 && r.Method == "GET" {
+		sseHandler(w, r, ssn)
+		return
+	}
+	if err := ssn.hold(); err != nil {
+		restErr(w, err)
+		return
+	}
+	defer ssn.release()
+
+	var t *gdbTarget
+	var err error
+	req := &clientBody{Ctx: "cmd", Data: make(map[string]interface{})}
+	if id := r.URL.Query().Get("target"); len(id) > 0 {
+		req.Data["target"] = id
+	}
+	if doErr := ssn.do(func() { t, err = ssn.targetOf(req) }); doErr != nil {
+		err = doErr
+	}
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+	if err = restReadBody(r, req); err != nil {
+		restErr(w, err)
+		return
+	}
+
+	switch {
+	case parts[1] == "run" && len(parts) == 2 && r.Method == "POST":
+		restRun(w, t, req)
+	case parts[1] == "threads" && len(parts) == 2 && r.Method == "GET":
+		restThreads(w, r, t)
+	case parts[1] == "breakpoints" && len(parts) <= 3:
+		restBkpts(w, r, t, parts[2:], req)
+	case parts[1] == "exec" && len(parts) == 3 && r.Method == "POST":
+		restExec(w, r, t, parts[2], req)
+	default:
+		restErr(w, &protoError{codeUnknownCmd, fmt.Sprintf("unknown endpoint: %s %s", r.Method, r.URL.Path)})
+	}
+}
+
+func restListSsns(w http.ResponseWriter, r *http.Request) {
+
+	ssnsMtx.Lock()
+	list := make([]*nvlvSsn, 0, len(ssns))
+	for _, ssn := range ssns {
+		list = append(list, ssn)
+	}
+	ssnsMtx.Unlock()
+
+	infos := make([]*ssnInfo, 0, len(list))
+	for _, ssn := range list {
+		if !ssn.allows(identityOf(r)) {
+			continue
+		}
+		var info *ssnInfo
+		if ssn.do(func() { info = ssn.info() }) == nil {
+			infos = append(infos, info)
+		}
+	}
+	restJson(w, http.StatusOK, infos)
+}
+
+// Starts a session, and its GDB on "exe" when one is given.
+func restCreateSsn(w http.ResponseWriter, r *http.Request) {
+
+	req := &clientBody{Ctx: "cmd", Data: make(map[string]interface{})}
+	if err := restReadBody(r, req); err != nil {
+		restErr(w, err)
+		return
+	}
+	ssn, err := newNvlvSsn()
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+	ssn.owner = identityOf(r)
+	ssn.recordClient("rest", r)
+	go runSsn(ssn)
+
+	var info *ssnInfo
+	doErr := ssn.do(func() {
+		if exe, _ := req.Data["exe"].(string); len(exe) > 0 {
+			t, l := ssn.cur, req.launch()
+			if err = t.gdbSsn.StartContext(t.ctx, exe, l.Args...); err != nil {
+				err = fmt.Errorf("Err: Unable to start gdb ssn: %w", err)
+				return
+			}
+			t.restoreExeSettings(exe, l)
+		}
+		info = ssn.info()
+	})
+	if doErr != nil {
+		err = doErr
+	}
+	if err != nil {
+		ssn.cancel()
+		restErr(w, err)
+		return
+	}
+	restJson(w, http.StatusCreated, info)
+}
+
+func restRun(w http.ResponseWriter, t *gdbTarget, req *clientBody) {
+
+	var err error
+	doErr := t.ssn.do(func() {
+		if err = t.setLaunch(req.launch()); err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+		err = t.gdbSsn.RunContext(ctx, nil)
+		cancel()
+	})
+	if doErr != nil {
+		err = doErr
+	}
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+	restJson(w, http.StatusOK, t.gdbSsn.Target())
+}
+
+// Replies with the threads and their stacks and variables. Collected
+// off the Run loop, it takes a while.
+func restThreads(w http.ResponseWriter, r *http.Request, t *gdbTarget) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), threadsTimeout)
+	defer cancel()
+	threads, err := getThreadsWithBt(ctx, t.gdbSsn)
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+	restJson(w, http.StatusOK, threads)
+}
+
+// Lists, inserts and deletes breakpoints. Changes are saved with the
+// exe settings and sent to the websocket client like -bp-* commands.
+func restBkpts(w http.ResponseWriter, r *http.Request, t *gdbTarget, number []string, req *clientBody) {
+
+	bps := t.gdbSsn.Breakpoints()
+	var result interface{}
+	var err error
+	var change func(ctx context.Context)
+
+	switch {
+	case r.Method == "GET" && len(number) == 0:
+		ctx, cancel := context.WithTimeout(r.Context(), cmdTimeout)
+		err = bps.Refresh(ctx)
+		cancel()
+		result = bps.List()
+
+	case r.Method == "POST" && len(number) == 0:
+		loc, _ := req.Data["location"].(string)
+		if len(loc) == 0 {
+			restErr(w, badRequest("argument error: no location given"))
+			return
+		}
+		change = func(ctx context.Context) {
+			result, err = bps.Insert(ctx, loc, bpOpts(req.Data))
+		}
+
+	case r.Method == "DELETE" && len(number) == 1:
+		// the number goes into an MI command, "%0A" in the path would end it
+		if _, err := strconv.ParseUint(number[0], 10, 32); err != nil {
+			restErr(w, badRequest("invalid breakpoint number: %q", number[0]))
+			return
+		}
+		change = func(ctx context.Context) {
+			if err = bps.Delete(ctx, number[0]); err == nil {
+				result = bps.List()
+			}
+		}
+
+	default:
+		restMethodNotAllowed(w, r)
+		return
+	}
+
+	if change != nil {
+		doErr := t.ssn.do(func() {
+			ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+			change(ctx)
+			cancel()
+			t.saveExeSettings()
+			t.cmdMsgBody.send(t.ssn.ws, "-bp-list", bps.List())
+		})
+		if doErr != nil {
+			err = doErr
+		}
+	}
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+	status := http.StatusOK
+	if r.Method == "POST" {
+		status = http.StatusCreated
+	}
+	restJson(w, status, result)
+}
+
+// Runs an exec command and replies with the stop event once the program
+// stops, or fails when the request is cancelled first.
+func restExec(w http.ResponseWriter, r *http.Request, t *gdbTarget, name string, req *clientBody) {
+
+	fn, ok := execCmds["-exec-"+name]
+	if !ok {
+		restErr(w, &protoError{codeUnknownCmd, "unknown exec command: " + name})
+		return
+	}
+	ev, err := fn(r.Context(), t.gdbSsn, req.args())
+	if err != nil {
+		restErr(w, err)
+		return
+	}
+	restJson(w, http.StatusOK, ev)
+}
+
+// Reads the JSON object in the body of r, if any, into the data of req.
+func restReadBody(r *http.Request, req *clientBody) error {
+	if r.Body == nil {
+		return nil
+	}
+	err := json.NewDecoder(r.Body).Decode(&req.Data)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return badRequest("malformed body: %v", err)
+	}
+	if req.Data == nil {
+		req.Data = make(map[string]interface{})
+	}
+	return nil
+}
+
+func restJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func restErr(w http.ResponseWriter, v interface{}) {
+	pe := toProtoError(v)
+	restJson(w, restStatus(pe.Code), map[string]*protoError{"error": pe})
+}
+
+func restMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	restJson(w, http.StatusMethodNotAllowed, map[string]*protoError{
+		"error": badRequest("method %s not allowed on %s", r.Method, r.URL.Path),
+	})
+}
+
+// The HTTP status for an error code.
+func restStatus(code string) int {
+	switch code {
+	case codeBadRequest:
+		return http.StatusBadRequest
+	case codeUnauthorized:
+		return http.StatusUnauthorized
+	case codeForbidden:
+		return http.StatusForbidden
+	case codeNoSession, codeNoTarget, codeUnknownCmd:
+		return http.StatusNotFound
+	case codeNotStarted, codeGdbExited:
+		return http.StatusConflict
+	case codeGdbError:
+		return http.StatusUnprocessableEntity
+	case codeTimeout:
+		return http.StatusGatewayTimeout
+	case codeUnsupported:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
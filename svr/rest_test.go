@@ -0,0 +1,94 @@
+package svr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Starts a session that gives up on clients after grace, it is ended
+// when the test ends.
+func startTestSsn(t *testing.T, grace time.Duration) *nvlvSsn {
+	t.Helper()
+	dir, old := ssnBaseDir, reconnectGrace
+	ssnBaseDir, reconnectGrace = t.TempDir(), grace
+	ssn, err := newNvlvSsn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// registered now so requests find it right away
+	registerSsn(ssn)
+	ended := make(chan struct{})
+	go func() {
+		runSsn(ssn)
+		close(ended)
+	}()
+	t.Cleanup(func() {
+		ssn.cancel()
+		<-ended
+		ssnBaseDir, reconnectGrace = dir, old
+	})
+	return ssn
+}
+
+func ssnEnds(ssn *nvlvSsn, within time.Duration) bool {
+	select {
+	case <-ssn.ctx.Done():
+		return true
+	case <-time.After(within):
+		return false
+	}
+}
+
+func TestSsnEndsWithoutClients(t *testing.T) {
+
+	ssn := startTestSsn(t, 50*time.Millisecond)
+	if !ssnEnds(ssn, 5*time.Second) {
+		t.Fatal("the session outlived the reconnect grace")
+	}
+	for i := 0; lookupSsn(ssn.token) != nil; i++ {
+		if i == 100 {
+			t.Fatal("the ended session is still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHoldKeepsSsnAlive(t *testing.T) {
+
+	ssn := startTestSsn(t, 50*time.Millisecond)
+	if err := ssn.hold(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ssn.hold(); err != nil {
+		t.Fatal(err)
+	}
+	if ssnEnds(ssn, 200*time.Millisecond) {
+		t.Fatal("the session ended while requests were in flight")
+	}
+	ssn.release()
+	if ssnEnds(ssn, 200*time.Millisecond) {
+		t.Fatal("the session ended while a request was in flight")
+	}
+	ssn.release()
+	if !ssnEnds(ssn, 5*time.Second) {
+		t.Fatal("the session outlived its requests by more than the reconnect grace")
+	}
+	if err := ssn.hold(); err != errSsnEnded {
+		t.Errorf("hold on an ended session: got %v, want errSsnEnded", err)
+	}
+}
+
+func TestRestDeleteBreakpointNumber(t *testing.T) {
+
+	ssn := startTestSsn(t, time.Minute)
+	for _, path := range []string{"/1%0A-gdb-exit", "/x", "/-1", "/1.1"} {
+		r := httptest.NewRequest("DELETE", RestPath+"/"+ssn.token+"/breakpoints"+path, nil)
+		w := httptest.NewRecorder()
+		restHandler(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("DELETE %s: got %d %s, want 400", path, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package svr
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"encoding/json"
+	"log"
+)
+
+// How many output messages are kept for a client that reconnects.
+const replaySize = 500
+
+// Where the messages of a session go. The websocket comes and goes with
+// the client, while there is none messages are dropped. The output of
+// the shell, the GDB and the program is also kept in a ring so a client
+// that reconnects can catch up. Only used from the Run loop.
+type wsSink struct {
+	conn *websocket.Conn
+	// The protocol version of the client, 0 for the original messages.
+	version int
+	// The request being handled, messages sent meanwhile answer it.
+	req    *clientBody
+	recent []*wsMsg
+	next   int
+	// The events for SSE clients.
+	events *sseHub
+}
+
+func newWsSink() *wsSink {
+	return &wsSink{recent: make([]*wsMsg, 0, replaySize), events: newSseHub()}
+}
+
+// Ctxs of the messages kept for replay.
+var replayCtxs = map[string]bool{"sh": true, "gdb": true, "tty": true}
+
+func (s *wsSink) send(m *wsMsg) error {
+
+	m.Type = msgEvent
+	if s.req != nil {
+		m.Type = msgResponse
+		m.Id = s.req.Id
+	} else {
+		s.events.publish(m)
+	}
+	if replayCtxs[m.Ctx] {
+		// replayed as events, the request is long answered and a client
+		// that reconnects may reuse its id
+		ev := m.asEvent()
+		if len(s.recent) < replaySize {
+			s.recent = append(s.recent, ev)
+		} else {
+			s.recent[s.next] = ev
+			s.next = (s.next + 1) % replaySize
+		}
+	}
+	return s.write(m)
+}
+
+// Sends m like send and passes it to the SSE clients as an event even
+// when it answers a request. The request isn't theirs but what came of
+// it, e.g. where the program stopped, is news to them as well.
+func (s *wsSink) broadcast(m *wsMsg) error {
+	answers := s.req != nil
+	err := s.send(m)
+	if answers {
+		s.events.publish(m.asEvent())
+	}
+	return err
+}
+
+func (s *wsSink) write(m *wsMsg) error {
+	if s.conn == nil {
+		return nil
+	}
+	var v interface{} = m
+	if s.version < protocolVersion {
+		v = m.legacy()
+	}
+	bts, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Err: Unable to encode message: ", err)
+		return err
+	}
+	err = websocket.Message.Send(s.conn, string(bts))
+	if err != nil {
+		log.Println("Err: Unable to send to client: ", err)
+	}
+	return err
+}
+
+// Sends the kept messages, oldest first.
+func (s *wsSink) replay() {
+	for i := range s.recent {
+		s.write(s.recent[(s.next+i)%len(s.recent)])
+	}
+}
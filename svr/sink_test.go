@@ -0,0 +1,35 @@
+package svr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWsSinkPublishesEvents(t *testing.T) {
+
+	s := newWsSink()
+	body := &clientBody{Ctx: "cmd", Data: map[string]interface{}{}}
+	req := &clientBody{Ctx: "cmd", Id: json.RawMessage(`7`)}
+
+	body.send(s, "-bp-list", []string{})
+	s.req = req
+	body.send(s, "-bp-list", []string{})
+	body.broadcast(s, "-exec-next", map[string]string{"reason": "end-stepping-range"})
+	s.req = nil
+	body.broadcast(s, "-exec-next", map[string]string{"reason": "end-stepping-range"})
+
+	// the reply to the request stays with the websocket, the stop doesn't
+	evs := s.events.since(0)
+	if len(evs) != 3 {
+		t.Fatalf("got %d events, want 3", len(evs))
+	}
+	for i, want := range []string{"-bp-list", "-exec-next", "-exec-next"} {
+		var m wsMsg
+		if err := json.Unmarshal(evs[i].data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != msgEvent || m.Id != nil || m.Data[want] == nil {
+			t.Errorf("event %d: %s", i, evs[i].data)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package svr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How many events are kept for SSE clients that resume.
+const sseRingSize = 1000
+
+// How many events an SSE client may fall behind before it is dropped,
+// it can resume with Last-Event-ID.
+const sseBacklog = 256
+
+// How often an idle SSE stream gets a comment so proxies keep it open.
+var sseKeepAlive = 30 * time.Second
+
+type sseEvent struct {
+	id   int64
+	ctx  string
+	data []byte
+}
+
+// The events of a session for SSE clients: the messages that aren't
+// replies to a request and the stops that are, see wsSink.broadcast,
+// numbered and encoded as in protocol version 1. Only used from the Run
+// loop.
+type sseHub struct {
+	ring   []*sseEvent
+	next   int
+	lastId int64
+	subs   map[chan *sseEvent]bool
+}
+
+func newSseHub() *sseHub {
+	return &sseHub{
+		ring: make([]*sseEvent, 0, sseRingSize),
+		subs: make(map[chan *sseEvent]bool),
+	}
+}
+
+func (h *sseHub) publish(m *wsMsg) {
+
+	bts, err := json.Marshal(m)
+	if err != nil {
+		log.Println("Err: Unable to encode event: ", err)
+		return
+	}
+	h.lastId++
+	ev := &sseEvent{h.lastId, m.Ctx, bts}
+	if len(h.ring) < sseRingSize {
+		h.ring = append(h.ring, ev)
+	} else {
+		h.ring[h.next] = ev
+		h.next = (h.next + 1) % sseRingSize
+	}
+	for c := range h.subs {
+		select {
+		case c <- ev:
+		default:
+			// too far behind, the client resumes from the ring
+			delete(h.subs, c)
+			close(c)
+		}
+	}
+}
+
+// Returns the kept events after id, oldest first.
+func (h *sseHub) since(id int64) []*sseEvent {
+	evs := make([]*sseEvent, 0)
+	for i := range h.ring {
+		if ev := h.ring[(h.next+i)%len(h.ring)]; ev.id > id {
+			evs = append(evs, ev)
+		}
+	}
+	return evs
+}
+
+func (h *sseHub) subscribe() chan *sseEvent {
+	c := make(chan *sseEvent, sseBacklog)
+	h.subs[c] = true
+	return c
+}
+
+func (h *sseHub) unsubscribe(c chan *sseEvent) {
+	if h.subs[c] {
+		delete(h.subs, c)
+		close(c)
+	}
+}
+
+// Streams the events of a session as Server-Sent Events. A client that
+// sends Last-Event-ID, or ?lastEventId= since EventSource can't set it
+// on the first request, first gets the kept events after that id. An
+// open stream keeps the session alive like an attached websocket.
+func sseHandler(w http.ResponseWriter, r *http.Request, ssn *nvlvSsn) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		restErr(w, &protoError{codeUnsupported, "streaming is not supported"})
+		return
+	}
+	lastId := r.Header.Get("Last-Event-ID")
+	if len(lastId) == 0 {
+		lastId = r.URL.Query().Get("lastEventId")
+	}
+	var last int64
+	if len(lastId) > 0 {
+		var err error
+		if last, err = strconv.ParseInt(lastId, 10, 64); err != nil {
+			restErr(w, badRequest("malformed Last-Event-ID: %q", lastId))
+			return
+		}
+	}
+
+	var backlog []*sseEvent
+	var sub chan *sseEvent
+	if err := ssn.do(func() {
+		if len(lastId) > 0 {
+			backlog = ssn.ws.events.since(last)
+		}
+		sub = ssn.ws.events.subscribe()
+		ssn.clients++
+	}); err != nil {
+		restErr(w, err)
+		return
+	}
+	defer ssn.later(func() {
+		ssn.ws.events.unsubscribe(sub)
+		ssn.clients--
+		ssn.resetIdle()
+	})
+	ssn.recordClient("events", r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, ev := range backlog {
+		writeSseEvent(w, ev)
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(sseKeepAlive)
+	defer ping.Stop()
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			if writeSseEvent(w, ev) != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+
+		case <-ssn.ctx.Done():
+			return
+		}
+	}
+}
+
+func writeSseEvent(w http.ResponseWriter, ev *sseEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.id, ev.ctx, ev.data)
+	return err
+}
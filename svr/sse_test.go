@@ -0,0 +1,54 @@
+package svr
+
+import (
+	"testing"
+)
+
+func TestSseHubSince(t *testing.T) {
+
+	h := newSseHub()
+	if evs := h.since(0); len(evs) != 0 {
+		t.Errorf("empty hub: got %d events", len(evs))
+	}
+
+	publish := func(n int) {
+		for i := 0; i < n; i++ {
+			h.publish(&wsMsg{V: protocolVersion, Type: msgEvent, Ctx: "gdb"})
+		}
+	}
+	check := func(after int64, first, last int64) {
+		t.Helper()
+		evs := h.since(after)
+		if want := int(last - first + 1); first > last && len(evs) != 0 || first <= last && len(evs) != want {
+			t.Fatalf("since(%d): got %d events", after, len(evs))
+		}
+		for i, ev := range evs {
+			if ev.id != first+int64(i) {
+				t.Fatalf("since(%d): event %d has id %d, want %d", after, i, ev.id, first+int64(i))
+			}
+		}
+	}
+
+	publish(10)
+	check(0, 1, 10)
+	check(7, 8, 10)
+	check(10, 1, 0)
+
+	// wrap the ring, only the last sseRingSize events are kept, oldest first
+	publish(sseRingSize + 5)
+	last := int64(sseRingSize + 15)
+	check(0, last-sseRingSize+1, last)
+	check(last-3, last-2, last)
+	check(last, 1, 0)
+
+	// subscribers that fall behind are dropped
+	c := h.subscribe()
+	publish(sseBacklog + 1)
+	n := 0
+	for range c {
+		n++
+	}
+	if n != sseBacklog {
+		t.Errorf("got %d events before the drop, want %d", n, sseBacklog)
+	}
+}
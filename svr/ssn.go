@@ -2,6 +2,8 @@ package svr
 
 import (
 	"code.google.com/p/go.net/websocket"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/tiffon/nvlv/svr/cmn"
 	"github.com/tiffon/nvlv/svr/gdb"
@@ -10,38 +12,65 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"strings"
 	"time"
 )
 
 type nvlvSsn struct {
 	dir           string
-	ws            *websocket.Conn
+	token         string
+	owner         string
+	ws            *wsSink
+	attachWs      chan *websocket.Conn
+	detachWs      chan *websocket.Conn
 	shMsgBody     *clientBody
-	exeMsgBody    *clientBody
-	gdbMsgBody    *clientBody
 	cmdMsgBody    *clientBody
 	shCmd         *cmn.CmdWrapper
-	gdbSsn        *gdb.Ssn
-	gdbErr        <-chan error
-	gdbExecOut    string
-	lastGdbRecs   []*gdb.Record
+	targets       map[string]*gdbTarget
+	cur           *gdbTarget
+	lastTargetId  int
 	msgFromClient chan *clientMsg
 	ssnErr        chan error
+	// Fires when no client has been around for reconnectGrace, nil
+	// while a websocket is attached or REST requests or event streams
+	// are open, which are counted in clients.
+	idle    <-chan time.Time
+	clients int
+	// Work handed back to the Run loop by background goroutines, the
+	// loop is the only writer to the websocket.
+	deferred chan func()
+	// Cancelled when the session ends, stops any pending GDB work.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func newNvlvSsn(ws *websocket.Conn) (*nvlvSsn, error) {
+// How long collecting the threads, stacks and variables may take.
+var threadsTimeout = time.Minute
+
+// How long a single GDB command issued on behalf of the client may take.
+var cmdTimeout = 15 * time.Second
+
+func newNvlvSsn() (*nvlvSsn, error) {
 	var err error
 	ssn := &nvlvSsn{}
 
-	ssn.dir, ssn.gdbExecOut, err = getSsnSpace()
+	if ssn.token, err = newSsnToken(); err != nil {
+		return nil, err
+	}
+
+	ssn.dir, err = getSsnSpace()
 	if err != nil {
 		log.Println("Err: Unable to create session storage locations: ", err)
 		return nil, err
 	}
 
-	ssn.ws = ws
+	ssn.ws = newWsSink()
+	ssn.attachWs = make(chan *websocket.Conn)
+	ssn.detachWs = make(chan *websocket.Conn)
+	ssn.msgFromClient = make(chan *clientMsg)
+	ssn.ctx, ssn.cancel = context.WithCancel(context.Background())
 	ssn.ssnErr = make(chan error)
+	ssn.deferred = make(chan func())
+	ssn.targets = make(map[string]*gdbTarget)
 	return ssn, nil
 }
 
@@ -49,41 +78,40 @@ func (ssn *nvlvSsn) SsnErr() <-chan error {
 	return ssn.ssnErr
 }
 
+// Runs f on the Run loop unless the session ends first.
+func (ssn *nvlvSsn) later(f func()) {
+	select {
+	case ssn.deferred <- f:
+	case <-ssn.ctx.Done():
+	}
+}
+
 func (ssn *nvlvSsn) Run() error {
 
 	var err error
+	defer ssn.cancel()
 
 	ssn.shMsgBody = &clientBody{
-		"sh",
-		make(map[string]interface{}),
-	}
-	ssn.exeMsgBody = &clientBody{
-		"exe",
-		make(map[string]interface{}),
-	}
-	ssn.gdbMsgBody = &clientBody{
-		"gdb",
-		make(map[string]interface{}),
+		Ctx:  "sh",
+		Data: make(map[string]interface{}),
 	}
 	ssn.cmdMsgBody = &clientBody{
-		"cmd",
-		make(map[string]interface{}),
+		Ctx:  "cmd",
+		Data: make(map[string]interface{}),
 	}
 
-	gdbErrChan := make(chan error)
-	ssn.gdbErr = gdbErrChan
-	ssn.gdbSsn = gdb.NewSsn(ssn.gdbExecOut, gdbErrChan)
-	gdbInferiorOut := ssn.gdbSsn.InferiorOutput()
-	gdbOutput := ssn.gdbSsn.GdbOutput()
+	// clients that don't know about targets use this one
+	ssn.createTarget()
 
 	ssn.shCmd = cmn.NewCmdWrapper(exec.Command("bash"))
-	if err = ssn.shCmd.Start(); err != nil {
+	if err = ssn.shCmd.StartContext(ssn.ctx); err != nil {
 		log.Println("Err: Unable to start shell command for nvlv session: ", err)
 		return err
 	}
 
-	ssn.msgFromClient = make(chan *clientMsg)
-	go recvJsonLoop(ssn.ws, ssn.msgFromClient)
+	// the client is not attached yet, the session waits for it as if it
+	// had gone away
+	ssn.idle = time.After(reconnectGrace)
 
 	for {
 		select {
@@ -100,27 +128,32 @@ func (ssn *nvlvSsn) Run() error {
 				err = m.Err
 				goto endConn
 			}
-			ssn.shMsgBody.sendErr(ssn.ws, m.Msg)
+			ssn.shMsgBody.sendErr(ssn.ws, &protoError{codeStderr, m.Msg})
 
-		case err = <-gdbErrChan:
-			log.Println("gbd err: ", err)
-			ssn.gdbMsgBody.sendErr(ssn.ws, err.Error())
-			goto endConn
+		case m := <-ssn.msgFromClient:
+			log.Println("msg from client:", m.data)
+			err = handleMsg(ssn, m)
 
-		case s := <-gdbInferiorOut:
-			ssn.exeMsgBody.sendMsg(ssn.ws, s)
+		case f := <-ssn.deferred:
+			f()
 
-		case gdbMsg := <-gdbOutput:
-			ssn.lastGdbRecs = gdbMsg.Records
-			ssn.gdbMsgBody.sendData(ssn.ws, gdbMsg.Records, "raw", gdbMsg.Raw)
+		case ws := <-ssn.attachWs:
+			ssn.idle = nil
+			ssn.onAttach(ws)
 
-		case m := <-ssn.msgFromClient:
-			if isReadErr(m.err, "client") {
-				err = m.err
-				goto endConn
+		case ws := <-ssn.detachWs:
+			if ws == ssn.ws.conn {
+				ssn.ws.conn = nil
+				ssn.resetIdle()
 			}
-			log.Println("msg from client:", m.data)
-			err = handleMsg(ssn, m)
+
+		case <-ssn.idle:
+			err = errors.New("no client reconnected")
+			goto endConn
+
+		case <-ssn.ctx.Done():
+			err = ssn.ctx.Err()
+			goto endConn
 		}
 	}
 
@@ -129,95 +162,130 @@ endConn:
 	log.Println("Killing cmds")
 
 	if ssn.shCmd.IsStarted() && !ssn.shCmd.IsKilled() {
-		ssn.shCmd.InChan() <- "exit"
-		ssn.shCmd.KillRelease()
+		select {
+		case ssn.shCmd.InChan() <- "exit":
+		case <-ssn.shCmd.Done():
+		}
+		ssn.shCmd.Kill()
+	}
+	for _, t := range ssn.targets {
+		t.close()
+	}
+	if ssn.ws.conn != nil {
+		ssn.ws.conn.Close()
 	}
-	ssn.gdbSsn.Kill()
 
 	return err
 }
 
+// Starts waiting reconnectGrace for a client unless one is around, a
+// websocket, a REST request in flight or an event stream.
+func (ssn *nvlvSsn) resetIdle() {
+	if ssn.ws.conn != nil || ssn.clients > 0 {
+		ssn.idle = nil
+		return
+	}
+	ssn.idle = time.After(reconnectGrace)
+}
+
+// Runs f on the Run loop like later, messages sent by f answer req.
+func (ssn *nvlvSsn) laterReply(req *clientBody, f func()) {
+	ssn.later(func() {
+		ssn.ws.req = req
+		defer func() { ssn.ws.req = nil }()
+		f()
+	})
+}
+
 func handleMsg(ssn *nvlvSsn, msg *clientMsg) error {
 
+	if msg.err != nil {
+		ssn.cmdMsgBody.sendErr(ssn.ws, badRequest("malformed message: %v", msg.err))
+		return nil
+	}
+	// replies follow the protocol version of the request and carry its id
+	ssn.ws.version = msg.data.V
+	ssn.ws.req = msg.data
+	defer func() { ssn.ws.req = nil }()
+	if err := msg.data.normalize(); err != nil {
+		ssn.cmdMsgBody.sendErr(ssn.ws, err)
+		return nil
+	}
+
 	switch msg.data.Ctx {
 
 	case "sh":
 		if s, ok := msg.data.Data["cmd"].(string); ok {
 			ssn.shCmd.InChan() <- s
 		} else {
-			ssn.shMsgBody.sendErr(ssn.ws, `unable to cast Data["cmd"] to string`)
+			ssn.shMsgBody.sendErr(ssn.ws, badRequest(`unable to cast Data["cmd"] to string`))
 		}
 
 	case "gdb":
-		if !ssn.gdbSsn.IsStarted() {
-			ssn.gdbMsgBody.sendErr(ssn.ws, `The gdb process is not started.`)
+		t := ssn.targetOrErr(msg.data)
+		if t == nil {
+			break
+		}
+		if !t.gdbSsn.IsStarted() {
+			t.gdbMsgBody.sendErr(t.ssn.ws, &protoError{codeNotStarted, `The gdb process is not started.`})
 			break
 		}
-		if ssn.gdbSsn.IsKilled() {
-			ssn.gdbMsgBody.sendErr(ssn.ws, `The gdb process has been killed and must be restarted.`)
+		if t.gdbSsn.IsKilled() {
+			t.gdbMsgBody.sendErr(t.ssn.ws, &protoError{codeGdbExited, `The gdb process has exited or been killed and must be restarted with -gdb-restart.`})
 			break
 		}
 		if s, ok := msg.data.Data["cmd"].(string); ok {
-			ssn.gdbSsn.Input() <- []string{s}
+			if err := t.gdbSsn.SendRaw(t.ssn.ctx, s); err != nil {
+				t.gdbMsgBody.sendErr(t.ssn.ws, err)
+			}
 		} else {
-			s = fmt.Sprintf("Unrecognized cmd value: %v\n", msg.data.Data["cmd"])
-			ssn.gdbMsgBody.sendErr(ssn.ws, s)
+			t.gdbMsgBody.sendErr(t.ssn.ws, badRequest("Unrecognized cmd value: %v\n", msg.data.Data["cmd"]))
+		}
+
+	case "tty":
+		t := ssn.targetOrErr(msg.data)
+		if t == nil {
+			break
+		}
+		// input for the program being debugged, sent as is so the
+		// client decides on line endings
+		if !t.gdbSsn.IsStarted() || t.gdbSsn.IsKilled() {
+			t.ttyMsgBody.sendErr(t.ssn.ws, &protoError{codeNotStarted, `The gdb process is not running.`})
+			break
+		}
+		if s, ok := msg.data.Data["input"].(string); ok {
+			if err := t.gdbSsn.SendInferior(t.ssn.ctx, s); err != nil {
+				t.ttyMsgBody.sendErr(t.ssn.ws, err)
+			}
+		} else {
+			t.ttyMsgBody.sendErr(t.ssn.ws, badRequest(`unable to cast Data["input"] to string`))
 		}
 
 	case "cmd":
 		log.Println("have a command")
 		adminCmd, ok := msg.data.Data["cmd"].(string)
 		if !ok {
-			s := fmt.Sprintf("Unrecognized cmd value: %v\n", msg.data.Data["cmd"])
-			ssn.cmdMsgBody.sendErr(ssn.ws, s)
+			ssn.cmdMsgBody.sendErr(ssn.ws, badRequest("Unrecognized cmd value: %v\n", msg.data.Data["cmd"]))
 			break
 		}
-		ssn.cmdMsgBody.sendMsg(ssn.ws, adminCmd)
 
+		// commands that don't involve a gdb session
 		switch adminCmd {
 
-		case "-gdb-start":
-			log.Println("-gdb-start cmd")
-
-			var execFile string
-			if args, ok := msg.data.Data["args"]; ok {
+		case "-ssn-create", "-ssn-list", "-ssn-switch", "-ssn-destroy":
+			ssn.cmdMsgBody.sendMsg(ssn.ws, adminCmd)
+			handleSsnCmd(ssn, adminCmd, msg.data)
 
-				switch v := args.(type) {
-				case []interface{}:
-					for _, elm := range v {
-						execFile += fmt.Sprintf("%v ", elm)
-					}
-					execFile = strings.TrimSpace(execFile)
-
-				default:
-					execFile = fmt.Sprintf("%v", args)
-				}
-			}
-
-			if err := ssn.gdbSsn.Start(execFile); err != nil {
-				s := fmt.Sprintf("Err: Unable to start gdb ssn: %s", err.Error())
-				ssn.cmdMsgBody.sendErr(ssn.ws, s)
-				log.Println(s)
-			}
-			ssn.cmdMsgBody.sendMsg(ssn.ws, "gdb process started")
-
-		case "-gdb-run":
-			ssn.gdbSsn.Run()
-			ssn.cmdMsgBody.sendMsg(ssn.ws, "gdb run called")
-
-		case "-gdb-get-threads-frames":
-			threadInfo, _, err := getThreadsWithBt(ssn)
-			if err != nil {
-				ssn.cmdMsgBody.sendErr(ssn.ws, err.Error(), "threadInfo", threadInfo)
-				return nil
-			}
-			ssn.cmdMsgBody.send(ssn.ws, "-gdb-get-threads-frames", threadInfo)
+		case "-proc-list":
+			ssn.cmdMsgBody.sendMsg(ssn.ws, adminCmd)
+			handleProcList(ssn)
 
 		case "-see-files":
+			ssn.cmdMsgBody.sendMsg(ssn.ws, adminCmd)
 
 			names, ok := msg.data.Data["args"]
 			if !ok {
-				ssn.cmdMsgBody.sendErr(ssn.ws, "-see-files", "argument error: 'args' not found")
+				ssn.cmdMsgBody.sendErr(ssn.ws, badRequest("argument error: 'args' not found"), "cmd", "-see-files")
 				return nil
 			}
 			files := make(map[string]string)
@@ -251,11 +319,141 @@ func handleMsg(ssn *nvlvSsn, msg *clientMsg) error {
 			}
 			ssn.cmdMsgBody.send(ssn.ws, "-see-files", files)
 			return nil
+
+		default:
+			if t := ssn.targetOrErr(msg.data); t != nil {
+				return handleTargetCmd(t, adminCmd, msg.data)
+			}
 		}
 	}
 	return nil
 }
 
+// Handles the admin commands for a gdb session.
+func handleTargetCmd(t *gdbTarget, adminCmd string, msg *clientBody) error {
+
+	t.cmdMsgBody.sendMsg(t.ssn.ws, adminCmd)
+
+	switch adminCmd {
+
+	case "-gdb-start":
+		log.Println("-gdb-start cmd")
+
+		// the "exe" and "argv" or, from older clients, the "args"
+		// with the executable first
+		execFile, _ := msg.Data["exe"].(string)
+		launch := msg.launch()
+		if args := msg.args(); len(execFile) == 0 && len(args) > 0 {
+			execFile = args[0]
+			if launch.Args == nil && len(args) > 1 {
+				launch.Args = args[1:]
+			}
+		}
+
+		if err := t.gdbSsn.StartContext(t.ctx, execFile, launch.Args...); err != nil {
+			err = fmt.Errorf("Err: Unable to start gdb ssn: %w", err)
+			t.cmdMsgBody.sendErr(t.ssn.ws, err)
+			log.Println(err)
+			break
+		}
+		t.cmdMsgBody.sendMsg(t.ssn.ws, "gdb process started")
+		if len(execFile) > 0 {
+			t.restoreExeSettings(execFile, launch)
+		} else if err := t.setLaunch(launch); err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err)
+		}
+
+	case "-gdb-run":
+		// args, env and cwd given with the run apply to this run and
+		// the ones after it
+		launch := msg.launch()
+		if args := msg.args(); launch.Args == nil && len(args) > 0 {
+			launch.Args = args
+		}
+		if err := t.setLaunch(launch); err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err)
+			break
+		}
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+		err := t.gdbSsn.RunContext(ctx, nil)
+		cancel()
+		if err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err)
+			break
+		}
+		t.cmdMsgBody.sendMsg(t.ssn.ws, "gdb run called")
+
+	case "-gdb-restart":
+		// same program, launch settings and breakpoints, new GDB
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+		err := t.gdbSsn.Restart(ctx)
+		cancel()
+		if err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+			break
+		}
+		t.cmdMsgBody.send(t.ssn.ws, adminCmd, t.info())
+
+	case "-gdb-get-threads-frames":
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, threadsTimeout)
+		threadInfo, err := getThreadsWithBt(ctx, t.gdbSsn)
+		cancel()
+		if err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err, "threadInfo", threadInfo)
+			return nil
+		}
+		t.cmdMsgBody.send(t.ssn.ws, "-gdb-get-threads-frames", threadInfo)
+
+	case "-gdb-get-goroutines":
+		ctx, cancel := context.WithTimeout(t.ssn.ctx, threadsTimeout)
+		goroutines, err := t.gdbSsn.GetGoroutines(ctx, true)
+		cancel()
+		if err != nil {
+			t.cmdMsgBody.sendErr(t.ssn.ws, err, "goroutines", goroutines)
+			return nil
+		}
+		t.cmdMsgBody.send(t.ssn.ws, "-gdb-get-goroutines", goroutines)
+
+	case "-var-create", "-var-children", "-var-delete", "-var-update", "-var-list":
+		handleVarCmd(t, adminCmd, msg)
+
+	case "-watch-add", "-watch-remove", "-watch-list":
+		handleWatchCmd(t, adminCmd, msg)
+
+	case "-gdb-load-core":
+		handleLoadCore(t, msg)
+
+	case "-gdb-connect", "-gdb-serve":
+		handleRemoteCmd(t, adminCmd, msg)
+
+	case "-gdb-attach", "-gdb-detach":
+		handleAttachCmd(t, adminCmd, msg)
+
+	case "-bp-add", "-bp-delete", "-bp-enable", "-bp-disable", "-bp-condition", "-bp-after", "-bp-list":
+		handleBpCmd(t, adminCmd, msg)
+
+	default:
+		if fn, ok := execCmds[adminCmd]; ok {
+			handleExecCmd(t, adminCmd, fn, msg.args())
+			break
+		}
+		t.cmdMsgBody.sendErr(t.ssn.ws, &protoError{codeUnknownCmd, "unknown cmd: " + adminCmd})
+	}
+	return nil
+}
+
+// Returns the target named by the message or the current one. Replies
+// with an error on the message's ctx and returns nil if there is none.
+func (ssn *nvlvSsn) targetOrErr(msg *clientBody) *gdbTarget {
+	t, err := ssn.targetOf(msg)
+	if err != nil {
+		body := &clientBody{Ctx: msg.Ctx, Data: make(map[string]interface{})}
+		body.sendErr(ssn.ws, err)
+		return nil
+	}
+	return t
+}
+
 func readFile(name string) (contents string, err error) {
 
 	f, err := os.Open(name)
@@ -268,91 +466,40 @@ func readFile(name string) (contents string, err error) {
 	return
 }
 
-func getThreadsWithBt(ssn *nvlvSsn) (threadsBt []map[string]interface{}, skipped [][]*gdb.Record, err error) {
+func getThreadsWithBt(ctx context.Context, gdbSsn *gdb.Ssn) (threads []*gdb.Thread, err error) {
 
-	gdbSsn := ssn.gdbSsn
-	timeout := 15 * time.Second
-	i, resp, rSkip, err := gdbSsn.GetResponse("-thread-info", timeout)
+	i, resp, err := gdbSsn.GetResponseContext(ctx, "-thread-info")
 	if err != nil {
 		return
 	}
-	if len(rSkip) > 0 {
-		skipped = append(skipped, rSkip...)
-	}
 
 	// now that have the list of threads collect stack info for each
-	threads, ok := resp.Records[i].Data["threads"].([]interface{})
-	if !ok {
-		err = fmt.Errorf("unknown 'threads' type: %t", resp.Records[i].Data["threads"])
+	threads, _, err = gdb.DecodeThreadInfo(resp.Records[i].Data)
+	if err != nil {
 		return
 	}
-	threadsBt = make([]map[string]interface{}, 0, len(threads))
 
 	// get a backtrace for each thread
-	for _, th := range threads {
+	for _, thread := range threads {
 
-		thread, ok := th.(map[string]interface{})
-		if !ok {
-			err = fmt.Errorf("unknown thread type: %t", th)
-			return
-		}
-		threadsBt = append(threadsBt, thread)
-		id, ok := thread["id"].(string)
-		if !ok {
-			err = fmt.Errorf("unknown id type: %t", thread["id"])
-			return
-		}
-		i, resp, rSkip, err = gdbSsn.GetResponse("-stack-list-frames --thread "+id, timeout)
-		if len(rSkip) > 0 {
-			skipped = append(skipped, rSkip...)
-		}
+		i, resp, err = gdbSsn.GetResponseContext(ctx, "-stack-list-frames --thread "+thread.Id)
 		if err != nil {
 			return
 		}
-		v := resp.Records[i].Data["stack"]
-		thread["stack"] = v
-
-		// get the args for each call in the stack...
-		// stack info from backtrace
-		stackData, ok := v.([]interface{})
-		if !ok {
-			err = fmt.Errorf("unknown stack type: %t", v)
+		thread.Stack, err = gdb.DecodeStack(resp.Records[i].Data)
+		if err != nil {
 			return
 		}
 
-		for _, frm := range stackData {
-
-			// drill down to frame
-			frmNV, ok := frm.(gdb.NamedValue)
-			if !ok {
-				err = fmt.Errorf("unknown frame type: %t", frm)
-				return
-			}
-			frame, ok := frmNV.Data.(map[string]interface{})
-			if !ok {
-				err = fmt.Errorf("unknown frame value type: %t", frmNV.Data)
-				return
-			}
-
-			lvl, ok := frame["level"].(string)
-			if !ok {
-				err = fmt.Errorf("unable to find or cast frame level: %v", frame)
-				continue
-			}
-
-			// get the variables for this frame
-			fVars, rSkip, vErr := gdbSsn.GetFrameVars(id, lvl, timeout)
-			if len(rSkip) > 0 {
-				skipped = append(skipped, rSkip...)
-			}
-			if vErr != nil {
-				err = vErr
+		// get the variables for each frame in the stack
+		for _, frame := range thread.Stack {
+			frame.Variables, err = gdbSsn.GetFrameVarsContext(ctx, thread.Id, frame.Level)
+			if err != nil {
 				return
 			}
-			frame["variables"] = fVars
 		}
 	}
-	return threadsBt, skipped, err
+	return threads, nil
 }
 
 func isReadErr(err error, src string) bool {
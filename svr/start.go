@@ -2,40 +2,97 @@ package svr
 
 import (
 	"bufio"
-	"code.google.com/p/go.net/websocket"
 	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 var listener net.Listener
 var ssnBaseDir string
 var HandlerPath string = "/nvlv"
 
-func Start(ssnDir, port string) {
+func Start(cfg *Config) {
 
-	ssnBaseDir = ssnDir
-
-	fmt.Println("Handler path: ", HandlerPath)
-	fmt.Println("Handler port: ", port)
-	fmt.Println("Session dir:  ", ssnDir)
+	ssnBaseDir = cfg.SessionDir
+	gdb.GdbBinPath = cfg.GdbPath
+	gdb.RuntimeGdbPy = cfg.RuntimeGdbPy
+	gdb.GdbServerPath = cfg.GdbServer
+	if len(cfg.ReconnectGrace) > 0 {
+		d, err := time.ParseDuration(cfg.ReconnectGrace)
+		if err != nil {
+			log.Fatal("invalid reconnect-grace: ", err)
+		}
+		reconnectGrace = d
+	}
+	if err := loadAuth(cfg); err != nil {
+		log.Fatal("auth setup err: ", err)
+	}
+	addr, err := listenAddr(cfg.Port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := gdb.Discover(); err != nil {
+		log.Fatal("gdb setup err: ", err)
+	}
 
-	http.Handle(HandlerPath, websocket.Handler(connHandler))
+	// with DAP on stdio stdout belongs to the DAP client
+	out := os.Stdout
+	if cfg.Dap == "stdio" {
+		out = os.Stderr
+	}
+	fmt.Fprintln(out, "Handler path: ", HandlerPath)
+	fmt.Fprintln(out, "REST path:    ", RestPath)
+	fmt.Fprintln(out, "Handler port: ", addr)
+	fmt.Fprintln(out, "Session dir:  ", cfg.SessionDir)
+	fmt.Fprintln(out, "GDB:          ", gdb.GdbBinPath)
+	fmt.Fprintln(out, "Go support:   ", gdb.RuntimeGdbPy)
+	fmt.Fprintln(out, "gdbserver:    ", gdb.GdbServerPath)
+	fmt.Fprintln(out, "Reconnect:    ", reconnectGrace)
+	if len(cfg.Dap) > 0 {
+		fmt.Fprintln(out, "DAP:          ", cfg.Dap)
+	}
+	fmt.Fprintln(out, "Token file:   ", cfg.TokenFile)
+	fmt.Fprintln(out, "HMAC key:     ", cfg.HmacKeyFile)
+	fmt.Fprintln(out, "Origins:      ", cfg.AllowedOrigins)
+	if !authEnabled() {
+		log.Println("Warning: no token file or HMAC key, only clients on this " +
+			"machine can connect and any of them gets a shell")
+	}
 
-	// need this or will shadow listener
-	var err error
+	http.Handle(HandlerPath, guard(wsServer()))
+	http.Handle(RestPath, guard(http.HandlerFunc(restHandler)))
+	http.Handle(RestPath+"/", guard(http.HandlerFunc(restHandler)))
 
-	listener, err = net.Listen("tcp", port)
+	listener, err = net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatal("net.Listen err: ", err)
 	}
 
-	go svrInputLoop()
-	go svrSignalTrap()
+	switch cfg.Dap {
+	case "":
+		go svrInputLoop()
+	case "stdio":
+		// the server ends with the DAP client
+		go func() {
+			if err := serveDap(cfg.Dap); err != nil {
+				log.Println("dap err: ", err)
+			}
+			listener.Close()
+		}()
+	default:
+		go svrInputLoop()
+		go func() {
+			log.Fatal("dap err: ", serveDap(cfg.Dap))
+		}()
+	}
+	go svrSignalTrap(out)
 
 	err = http.Serve(listener, nil)
 
@@ -65,10 +122,10 @@ func svrInputLoop() {
 	}
 }
 
-func svrSignalTrap() {
+func svrSignalTrap(out io.Writer) {
 	var interrupted = make(chan os.Signal)
 	signal.Notify(interrupted, syscall.SIGQUIT, syscall.SIGINT)
 	<-interrupted
-	fmt.Printf("\n\033[33mExiting...\033[0m\n")
+	fmt.Fprintf(out, "\n\033[33mExiting...\033[0m\n")
 	listener.Close()
 }
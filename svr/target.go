@@ -0,0 +1,249 @@
+package svr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// One of the GDB sessions of a connection. Messages to and from the
+// client name the target by id in Data["target"], messages without one
+// go to the current target. Each target has its own message bodies so
+// everything it sends carries its id.
+type gdbTarget struct {
+	id           string
+	ssn          *nvlvSsn
+	gdbSsn       *gdb.Ssn
+	gdbErr       chan error
+	execOut      string
+	lastGdbRecs  []*gdb.Record
+	exe          *exeSettings
+	watches      *watchList
+	ttyMsgBody   *clientBody
+	gdbMsgBody   *clientBody
+	cmdMsgBody   *clientBody
+	watchMsgBody *clientBody
+	// The GDB outlives the connection's ctx until the session has
+	// cleaned up after it, e.g. detached from an attached process.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// A target as listed for the client.
+type targetInfo struct {
+	Id      string     `json:"id"`
+	Current bool       `json:"current"`
+	Started bool       `json:"started"`
+	Killed  bool       `json:"killed"`
+	Exe     string     `json:"exe,omitempty"`
+	Target  gdb.Target `json:"target"`
+}
+
+var errNoTarget = errors.New("no gdb session, create one with -ssn-create")
+
+func newGdbTarget(ssn *nvlvSsn, id string) *gdbTarget {
+
+	body := func(ctx string) *clientBody {
+		return &clientBody{Ctx: ctx, Data: map[string]interface{}{"target": id}}
+	}
+	t := &gdbTarget{
+		id:           id,
+		ssn:          ssn,
+		gdbErr:       make(chan error),
+		execOut:      fmt.Sprintf("%s%cprogramOut-%s.log", ssn.dir, os.PathSeparator, id),
+		watches:      newWatchList(),
+		ttyMsgBody:   body("tty"),
+		gdbMsgBody:   body("gdb"),
+		cmdMsgBody:   body("cmd"),
+		watchMsgBody: body("watch"),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.gdbSsn = gdb.NewSsn(t.execOut, t.gdbErr)
+	go t.forward(t.gdbSsn.Subscribe([]byte{gdb.NATURE_EXEC_OUT, gdb.NATURE_NOTIFY}, "stopped", "gdb-exited", "target-changed"))
+	return t
+}
+
+// Hands the output and events of the GDB to the Run loop, in order,
+// until the target is closed.
+func (t *gdbTarget) forward(sub *gdb.Subscription) {
+
+	g := t.gdbSsn
+	inferiorOut := g.InferiorOutput()
+	gdbOutput := g.GdbOutput()
+	events := sub.C
+	done := t.ctx.Done()
+	for {
+		select {
+		case err := <-t.gdbErr:
+			t.ssn.later(func() {
+				log.Println("gdb err: ", t.id, err)
+				t.gdbMsgBody.sendErr(t.ssn.ws, &protoError{codeStderr, err.Error()})
+			})
+
+		case s := <-inferiorOut:
+			t.ssn.later(func() {
+				t.ttyMsgBody.sendMsg(t.ssn.ws, s)
+			})
+
+		case gdbMsg := <-gdbOutput:
+			t.ssn.later(func() {
+				t.lastGdbRecs = gdbMsg.Records
+				t.gdbMsgBody.sendData(t.ssn.ws, gdbMsg.Records, "raw", gdbMsg.Raw)
+			})
+
+		case r, ok := <-events:
+			if !ok {
+				events = nil
+				break
+			}
+			t.ssn.later(func() {
+				t.onEvent(r)
+			})
+
+		case <-done:
+			return
+		}
+	}
+}
+
+func (t *gdbTarget) onEvent(r *gdb.Record) {
+	switch r.Class {
+	case "gdb-exited":
+		t.onGdbExit(r)
+	case "target-changed":
+		if tgt, err := gdb.DecodeTarget(r); err == nil {
+			t.gdbMsgBody.send(t.ssn.ws, "target", tgt)
+		}
+	default:
+		t.onStop(r)
+	}
+}
+
+// Tells the client the GDB process has ended and how.
+func (t *gdbTarget) onGdbExit(r *gdb.Record) {
+	ev, err := gdb.DecodeGdbExit(r)
+	if err != nil {
+		t.gdbMsgBody.sendErr(t.ssn.ws, err)
+		return
+	}
+	log.Println("gdb exited:", t.id, ev.ExitCode, ev.SignalName)
+	t.gdbMsgBody.send(t.ssn.ws, "gdb-exited", ev)
+}
+
+// Saves the settings of the target, detaches from an attached process
+// and ends the GDB.
+func (t *gdbTarget) close() {
+	t.saveExeSettings()
+	t.detachOnEnd()
+	t.gdbSsn.Close()
+	t.cancel()
+}
+
+func (t *gdbTarget) info() *targetInfo {
+	ti := &targetInfo{
+		Id:      t.id,
+		Current: t == t.ssn.cur,
+		Started: t.gdbSsn.IsStarted(),
+		Killed:  t.gdbSsn.IsKilled(),
+		Target:  t.gdbSsn.Target(),
+	}
+	if t.exe != nil {
+		ti.Exe = t.exe.Exe
+	}
+	return ti
+}
+
+// Adds a new target and makes it the current one.
+func (ssn *nvlvSsn) createTarget() *gdbTarget {
+	ssn.lastTargetId++
+	t := newGdbTarget(ssn, strconv.Itoa(ssn.lastTargetId))
+	ssn.targets[t.id] = t
+	ssn.cur = t
+	return t
+}
+
+// Returns the target named by the message or the current one.
+func (ssn *nvlvSsn) targetOf(msg *clientBody) (*gdbTarget, error) {
+	id, ok := msg.Data["target"]
+	if !ok {
+		if ssn.cur == nil {
+			return nil, errNoTarget
+		}
+		return ssn.cur, nil
+	}
+	t, ok := ssn.targets[fmt.Sprintf("%v", id)]
+	if !ok {
+		return nil, &protoError{codeNoTarget, fmt.Sprintf("unknown gdb session: %v", id)}
+	}
+	return t, nil
+}
+
+func (ssn *nvlvSsn) targetList() []*targetInfo {
+	list := make([]*targetInfo, 0, len(ssn.targets))
+	for _, t := range ssn.targets {
+		list = append(list, t.info())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].Id)
+		b, _ := strconv.Atoi(list[j].Id)
+		return a < b
+	})
+	return list
+}
+
+// Handles the admin commands that manage the GDB sessions of the
+// connection:
+//
+//	-ssn-create
+//	-ssn-list
+//	-ssn-switch <id>
+//	-ssn-destroy [<id>]
+//
+// Each replies with the resulting list of sessions keyed by the command
+// name. -ssn-create makes the new session current, destroying the
+// current session makes the one with the lowest id current.
+func handleSsnCmd(ssn *nvlvSsn, adminCmd string, msg *clientBody) {
+
+	args := msg.args()
+	switch adminCmd {
+
+	case "-ssn-create":
+		ssn.createTarget()
+
+	case "-ssn-switch":
+		if len(args) != 1 {
+			ssn.cmdMsgBody.sendErr(ssn.ws, badRequest("argument error: expected a session id"), "cmd", adminCmd)
+			return
+		}
+		t, ok := ssn.targets[args[0]]
+		if !ok {
+			ssn.cmdMsgBody.sendErr(ssn.ws, &protoError{codeNoTarget, "unknown gdb session: " + args[0]}, "cmd", adminCmd)
+			return
+		}
+		ssn.cur = t
+
+	case "-ssn-destroy":
+		t := ssn.cur
+		if len(args) > 0 {
+			t = ssn.targets[args[0]]
+		}
+		if t == nil {
+			ssn.cmdMsgBody.sendErr(ssn.ws, &protoError{codeNoTarget, "unknown gdb session"}, "cmd", adminCmd)
+			return
+		}
+		t.close()
+		delete(ssn.targets, t.id)
+		if t == ssn.cur {
+			ssn.cur = nil
+			if list := ssn.targetList(); len(list) > 0 {
+				ssn.cur = ssn.targets[list[0].Id]
+			}
+		}
+	}
+	ssn.cmdMsgBody.send(ssn.ws, adminCmd, ssn.targetList())
+}
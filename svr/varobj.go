@@ -0,0 +1,96 @@
+package svr
+
+import (
+	"context"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"strconv"
+)
+
+// Handles the -var-* admin commands used by the client to expand
+// values on demand:
+//
+//	-var-create <expr> [<thread> <frame>]
+//	-var-children <name>
+//	-var-delete <name>
+//	-var-update
+//	-var-list
+func handleVarCmd(t *gdbTarget, adminCmd string, msg *clientBody) {
+
+	args := msg.args()
+	vars := t.gdbSsn.VarObjs()
+	ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+	defer cancel()
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch adminCmd {
+
+	case "-var-create":
+		if len(args) != 1 && len(args) != 3 {
+			err = badRequest("argument error: expected expression and optional thread and frame")
+			break
+		}
+		var thread string
+		var frame int
+		if len(args) == 3 {
+			thread = args[1]
+			if frame, err = strconv.Atoi(args[2]); err != nil {
+				err = badRequest("argument error: invalid frame %q", args[2])
+				break
+			}
+		}
+		result, err = vars.Create(ctx, args[0], thread, frame)
+
+	case "-var-children":
+		if len(args) != 1 {
+			err = badRequest("argument error: expected variable object name")
+			break
+		}
+		result, err = vars.ListChildren(ctx, args[0])
+
+	case "-var-delete":
+		if len(args) != 1 {
+			err = badRequest("argument error: expected variable object name")
+			break
+		}
+		err = vars.Delete(ctx, args[0])
+		result = vars.List()
+
+	case "-var-update":
+		result, err = vars.Update(ctx)
+
+	case "-var-list":
+		result = vars.List()
+	}
+
+	if err != nil {
+		t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", adminCmd)
+		return
+	}
+	t.cmdMsgBody.send(t.ssn.ws, adminCmd, result)
+}
+
+// Called by the Run loop for every *stopped record. Pushes the watch
+// values and the changes to the variable objects the client is showing.
+func (t *gdbTarget) onStop(r *gdb.Record) {
+
+	ev, err := gdb.DecodeStoppedEvent(r)
+	if err != nil || gdb.IsExitReason(ev.Reason) {
+		return
+	}
+	t.evalWatches()
+
+	ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+	defer cancel()
+
+	changes, err := t.gdbSsn.VarObjs().Update(ctx)
+	if err != nil {
+		t.cmdMsgBody.sendErr(t.ssn.ws, err, "cmd", "-var-update")
+		return
+	}
+	if len(changes) > 0 {
+		t.cmdMsgBody.send(t.ssn.ws, "-var-update", changes)
+	}
+}
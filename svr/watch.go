@@ -0,0 +1,161 @@
+package svr
+
+import (
+	"context"
+	"github.com/tiffon/nvlv/svr/gdb"
+)
+
+// The value of a watch expression at a stop. Changed is set when the
+// value or error differs from the previous stop, which is in Prev.
+type watchValue struct {
+	Expr    string `json:"expr"`
+	Value   string `json:"value,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Prev    string `json:"prev,omitempty"`
+	Changed bool   `json:"changed"`
+}
+
+// Expressions evaluated automatically whenever the program stops.
+type watchList struct {
+	exprs []string
+	last  map[string]*watchValue
+}
+
+func newWatchList() *watchList {
+	return &watchList{make([]string, 0), make(map[string]*watchValue)}
+}
+
+// Adds expr unless it is already watched.
+func (w *watchList) add(expr string) {
+	for _, e := range w.exprs {
+		if e == expr {
+			return
+		}
+	}
+	w.exprs = append(w.exprs, expr)
+}
+
+func (w *watchList) remove(expr string) {
+	for i, e := range w.exprs {
+		if e == expr {
+			w.exprs = append(w.exprs[:i], w.exprs[i+1:]...)
+			delete(w.last, expr)
+			return
+		}
+	}
+}
+
+// Returns the values from the last evaluation, in watch order.
+func (w *watchList) values() []*watchValue {
+	vals := make([]*watchValue, 0, len(w.exprs))
+	for _, e := range w.exprs {
+		if v, ok := w.last[e]; ok {
+			vals = append(vals, v)
+		} else {
+			vals = append(vals, &watchValue{Expr: e})
+		}
+	}
+	return vals
+}
+
+// Evaluates every expression and diffs the results against the
+// previous evaluation. Stops early only if ctx is done.
+func (w *watchList) eval(ctx context.Context, g *gdb.Ssn) ([]*watchValue, error) {
+
+	vals := make([]*watchValue, 0, len(w.exprs))
+	for _, e := range w.exprs {
+		v, err := evalWatch(ctx, g, e)
+		if err != nil {
+			return vals, err
+		}
+		if prev, ok := w.last[e]; ok {
+			v.Prev = prev.Value
+			v.Changed = prev.Value != v.Value || prev.Error != v.Error
+		}
+		w.last[e] = v
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// Evaluates a single expression, errors in the expression go in the
+// value. Fails only if ctx is done.
+func evalWatch(ctx context.Context, g *gdb.Ssn, expr string) (*watchValue, error) {
+	v := &watchValue{Expr: expr}
+	val, err := g.Evaluate(ctx, expr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		v.Error = err.Error()
+	} else {
+		v.Value = val
+	}
+	return v, nil
+}
+
+// Handles the watch admin commands:
+//
+//	-watch-add <expr>...
+//	-watch-remove <expr>...
+//	-watch-list
+//
+// Each replies with the current values keyed by the command name.
+func handleWatchCmd(t *gdbTarget, adminCmd string, msg *clientBody) {
+
+	args := msg.args()
+	vals := t.watches.values()
+	switch adminCmd {
+
+	case "-watch-add":
+		if len(args) == 0 {
+			t.cmdMsgBody.sendErr(t.ssn.ws, badRequest("argument error: no expression given"))
+			return
+		}
+		for _, e := range args {
+			t.watches.add(e)
+		}
+		vals = t.watches.values()
+		// the new expressions are shown right away when the program is
+		// stopped, the values of the last stop stay the baseline the
+		// next stop is diffed against
+		if t.gdbSsn.IsStarted() && !t.gdbSsn.IsKilled() && t.gdbSsn.Target().State == gdb.STATE_STOPPED {
+			ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+			for i, v := range vals {
+				if _, ok := t.watches.last[v.Expr]; ok {
+					continue
+				}
+				if nv, err := evalWatch(ctx, t.gdbSsn, v.Expr); err == nil {
+					vals[i] = nv
+				}
+			}
+			cancel()
+		}
+
+	case "-watch-remove":
+		for _, e := range args {
+			t.watches.remove(e)
+		}
+		vals = t.watches.values()
+	}
+	t.saveExeSettings()
+	t.cmdMsgBody.send(t.ssn.ws, adminCmd, vals)
+}
+
+// Evaluates the watch expressions after a stop and pushes them to the
+// client on the watch ctx.
+func (t *gdbTarget) evalWatches() {
+
+	if len(t.watches.exprs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(t.ssn.ctx, cmdTimeout)
+	defer cancel()
+
+	vals, err := t.watches.eval(ctx, t.gdbSsn)
+	if err != nil {
+		t.watchMsgBody.sendErr(t.ssn.ws, err, "values", vals)
+		return
+	}
+	t.watchMsgBody.sendData(t.ssn.ws, vals)
+}
@@ -2,91 +2,353 @@ package svr
 
 import (
 	"code.google.com/p/go.net/websocket"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/tiffon/nvlv/svr/cmn"
+	"github.com/tiffon/nvlv/svr/gdb"
 	"log"
 )
 
+// Serves a websocket. A connection with ?ssn=<token> takes over the
+// session with that token, if it is still around, otherwise a new
+// session is started, as is one for a token created by someone else.
+// The session outlives the connection, see
+// reconnectGrace. A connection with ?v=1 speaks protocol version 1 from
+// the first message on, see protocol.schema.json.
 func connHandler(ws *websocket.Conn) {
 
-	ssn, err := newNvlvSsn(ws)
-	if err != nil {
-		s := "error creating nvlv session: " + err.Error()
-		log.Println(s)
-		websocket.Message.Send(ws, s)
+	r := ws.Request()
+	ssn := lookupSsn(r.URL.Query().Get("ssn"))
+	if ssn != nil && !ssn.allows(identityOf(r)) {
+		ssn = nil
+	}
+	if ssn == nil {
+		var err error
+		if ssn, err = newNvlvSsn(); err != nil {
+			s := "error creating nvlv session: " + err.Error()
+			log.Println(s)
+			websocket.Message.Send(ws, s)
+			return
+		}
+		ssn.owner = identityOf(r)
+		go runSsn(ssn)
+	}
+
+	if !ssn.attach(ws) {
+		websocket.Message.Send(ws, "error starting nvlv session: the session has ended")
 		return
 	}
+	ssn.recordClient("websocket", r)
+	recvJsonLoop(ssn.ctx, ws, ssn.msgFromClient)
+	ssn.detach(ws)
+}
 
-	err = ssn.Run()
-	if err != nil {
-		s := "error starting nvlv session: " + err.Error()
-		log.Println(s)
-		websocket.Message.Send(ws, s)
+// Registers a new session and runs it until it ends.
+func runSsn(ssn *nvlvSsn) {
+	registerSsn(ssn)
+	if err := ssn.Run(); err != nil {
+		log.Println("nvlv session ended: ", err)
 	}
+	unregisterSsn(ssn)
 }
 
-func recvJsonLoop(ws *websocket.Conn, resutlChan chan *clientMsg) {
+// Reads messages from the client until the connection fails or ctx is
+// done. A message that isn't valid JSON is passed on with its error so
+// the client can be told.
+func recvJsonLoop(ctx context.Context, ws *websocket.Conn, resutlChan chan *clientMsg) {
 	for {
+		var raw []byte
+		if err := websocket.Message.Receive(ws, &raw); isReadErr(err, "client") {
+			return
+		}
 		msg := new(clientMsg)
-		msg.err = websocket.JSON.Receive(ws, &msg.data)
-		resutlChan <- msg
+		if err := json.Unmarshal(raw, &msg.data); err != nil {
+			msg.data, msg.err = nil, err
+		}
+		select {
+		case resutlChan <- msg:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
+// The protocol version spoken by clients that send "v". Clients that
+// don't get the original {Ctx, Data} messages.
+const protocolVersion = 1
+
+// The types of protocol messages.
+const (
+	msgRequest  = "request"
+	msgResponse = "response"
+	msgEvent    = "event"
+)
+
+// The error codes sent to clients.
+const (
+	codeBadRequest         = "bad_request"
+	codeUnsupportedVersion = "unsupported_version"
+	codeUnknownCtx         = "unknown_ctx"
+	codeUnknownCmd         = "unknown_cmd"
+	codeNoTarget           = "no_target"
+	codeNoSession          = "no_session"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeNotStarted         = "not_started"
+	codeGdbExited          = "gdb_exited"
+	codeGdbError           = "gdb_error"
+	codeTimeout            = "timeout"
+	codeUnsupported        = "unsupported"
+	codeStderr             = "stderr"
+	codeInternal           = "internal"
+)
+
+// The ctxs a request can be sent on.
+var requestCtxs = map[string]bool{"sh": true, "gdb": true, "tty": true, "cmd": true}
+
+// An error as sent to the client, Code is one of the code* consts and
+// Message is for people.
+type protoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *protoError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, a ...interface{}) *protoError {
+	return &protoError{codeBadRequest, fmt.Sprintf(format, a...)}
+}
+
+// Returns the error to send for v, which is a *protoError, another error
+// whose code is derived from what it is, or anything else, which is an
+// internal error.
+func toProtoError(v interface{}) *protoError {
+
+	err, ok := v.(error)
+	if !ok {
+		return &protoError{codeInternal, fmt.Sprintf("%v", v)}
+	}
+	var pe *protoError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	var me *gdb.MIError
+	code := codeInternal
+	switch {
+	case errors.As(err, &me):
+		code = codeGdbError
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codeTimeout
+	case errors.Is(err, gdb.ErrTokenReserved), errors.Is(err, gdb.ErrMultiline), errors.Is(err, gdb.ErrBadAddr), errors.Is(err, gdb.ErrBadNumber):
+		code = codeBadRequest
+	case errors.Is(err, errNoTarget):
+		code = codeNoTarget
+	case errors.Is(err, gdb.ErrNotStarted):
+		code = codeNotStarted
+	case errors.Is(err, gdb.ErrIsKilled), errors.Is(err, gdb.ErrIoEnded), errors.Is(err, gdb.ErrGdbExited):
+		code = codeGdbExited
+	case errors.Is(err, gdb.ErrCoreTarget), errors.Is(err, gdb.ErrNoGdbServer), errors.Is(err, gdb.ErrCantRestart), errors.Is(err, cmn.ErrPtyUnsupported):
+		code = codeUnsupported
+	}
+	return &protoError{code, err.Error()}
+}
+
+// A message to the client in protocol version 1. Responses carry the id
+// of the request they answer, a request can have several, e.g. the
+// acknowledgement of a command and its result. Everything else is an
+// event. Messages are built anew for each send.
+type wsMsg struct {
+	V      int                    `json:"v"`
+	Type   string                 `json:"type"`
+	Id     json.RawMessage        `json:"id,omitempty"`
+	Ctx    string                 `json:"ctx"`
+	Target string                 `json:"target,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Error  *protoError            `json:"error,omitempty"`
+}
+
+// The message as sent to clients that predate the protocol versions,
+// the target and the error message are part of the data.
+func (m *wsMsg) legacy() *clientBody {
+
+	data := make(map[string]interface{}, len(m.Data)+2)
+	for k, v := range m.Data {
+		data[k] = v
+	}
+	if len(m.Target) > 0 {
+		data["target"] = m.Target
+	}
+	if m.Error != nil {
+		data["err"] = m.Error.Message
+	}
+	return &clientBody{Ctx: m.Ctx, Data: data}
+}
+
+// Returns a copy of m as an event, for clients other than the one whose
+// request it answers.
+func (m *wsMsg) asEvent() *wsMsg {
+	ev := *m
+	ev.Type, ev.Id = msgEvent, nil
+	return &ev
+}
+
 type clientMsg struct {
 	data *clientBody
 	err  error
 }
 
+// A request from the client. Older clients send only Ctx and Data, the
+// other fields come with protocol version 1. The server also uses bodies
+// as templates for the messages it sends, see send.
 type clientBody struct {
-	Ctx  string
-	Data map[string]interface{}
+	V      int             `json:"v,omitempty"`
+	Type   string          `json:"type,omitempty"`
+	Id     json.RawMessage `json:"id,omitempty"`
+	Target interface{}     `json:"target,omitempty"`
+	Ctx    string
+	Data   map[string]interface{}
+}
+
+// Checks a request and moves the target of a version 1 request into its
+// data, where the handlers look for it.
+func (c *clientBody) normalize() *protoError {
+
+	if c.V != 0 {
+		if c.V != protocolVersion {
+			return &protoError{codeUnsupportedVersion, fmt.Sprintf("unsupported protocol version %d, the server speaks %d", c.V, protocolVersion)}
+		}
+		if c.Type != msgRequest {
+			return badRequest("expected a message of type %q, found %q", msgRequest, c.Type)
+		}
+	}
+	if c.Data == nil {
+		c.Data = make(map[string]interface{})
+	}
+	if c.Target != nil {
+		c.Data["target"] = fmt.Sprintf("%v", c.Target)
+	}
+	if !requestCtxs[c.Ctx] {
+		return &protoError{codeUnknownCtx, fmt.Sprintf("unknown ctx: %q", c.Ctx)}
+	}
+	return nil
 }
 
-func (c *clientBody) sendErr(ws *websocket.Conn, msg interface{}, keyValPairs ...interface{}) {
+// Returns the launch settings of a message: the "argv" list, the "env"
+// object and the "cwd". Args are nil when there is no "argv".
+func (c *clientBody) launch() *gdb.Launch {
 
-	sendOnWS(c, ws, "err", msg, keyValPairs...)
+	l := &gdb.Launch{}
+	if v, ok := c.Data["argv"]; ok {
+		l.Args = strList(v)
+	}
+	if env, ok := c.Data["env"].(map[string]interface{}); ok {
+		l.Env = make(map[string]string, len(env))
+		for name, v := range env {
+			l.Env[name] = fmt.Sprintf("%v", v)
+		}
+	}
+	l.Dir, _ = c.Data["cwd"].(string)
+	return l
 }
 
-func (c *clientBody) sendMsg(ws *websocket.Conn, msg interface{}, keyValPairs ...interface{}) {
+// Returns the "args" of a message as strings. A single value is
+// treated as a list of one.
+func (c *clientBody) args() []string {
+
+	v, ok := c.Data["args"]
+	if !ok {
+		return nil
+	}
+	return strList(v)
+}
+
+func strList(v interface{}) []string {
+
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	args := make([]string, 0, len(list))
+	for _, elm := range list {
+		if s, ok := elm.(string); ok {
+			args = append(args, s)
+		} else {
+			args = append(args, fmt.Sprintf("%v", elm))
+		}
+	}
+	return args
+}
+
+// Sends an error, msg is turned into a *protoError by toProtoError.
+func (c *clientBody) sendErr(ws *wsSink, msg interface{}, keyValPairs ...interface{}) {
+
+	m, err := c.newMsg(keyValPairs)
+	if err != nil {
+		log.Println("Error appending extra key and values in send Err: ", err)
+	}
+	m.Error = toProtoError(msg)
+	ws.send(m)
+}
+
+func (c *clientBody) sendMsg(ws *wsSink, msg interface{}, keyValPairs ...interface{}) {
 
 	sendOnWS(c, ws, "msg", msg, keyValPairs...)
 }
 
-func (c *clientBody) sendData(ws *websocket.Conn, data interface{}, keyValPairs ...interface{}) {
+func (c *clientBody) sendData(ws *wsSink, data interface{}, keyValPairs ...interface{}) {
 
 	sendOnWS(c, ws, "data", data, keyValPairs...)
 }
 
-func (c *clientBody) send(ws *websocket.Conn, keyvals ...interface{}) error {
+func (c *clientBody) send(ws *wsSink, keyvals ...interface{}) error {
 
-	keys, err := cmn.AppendKVPs(c.Data, keyvals)
+	m, err := c.newMsg(keyvals)
 	if err != nil {
 		log.Println("Error appending extra key and values in send Err: ", err)
 		return err
 	}
-	websocket.JSON.Send(ws, c)
-
-	if keys != nil {
-		for _, key := range keys {
-			delete(c.Data, key)
-		}
-	}
-	return nil
+	return ws.send(m)
 }
 
-func sendOnWS(c *clientBody, ws *websocket.Conn, key string, data interface{}, keyValPairs ...interface{}) {
+// Like send, but when the message answers a request it also reaches the
+// SSE clients, see wsSink.broadcast.
+func (c *clientBody) broadcast(ws *wsSink, keyvals ...interface{}) error {
 
-	xtraKeys, err := cmn.AppendKVPs(c.Data, keyValPairs)
+	m, err := c.newMsg(keyvals)
 	if err != nil {
 		log.Println("Error appending extra key and values in send Err: ", err)
+		return err
 	}
-	c.Data[key] = data
-	websocket.JSON.Send(ws, c)
+	return ws.broadcast(m)
+}
 
-	delete(c.Data, key)
-	if xtraKeys != nil {
-		for _, key := range xtraKeys {
-			delete(c.Data, key)
-		}
+// Returns a message with the ctx, target and data of the body plus the
+// given keys and values. The body is left as it is.
+func (c *clientBody) newMsg(keyValPairs []interface{}) (*wsMsg, error) {
+
+	data := make(map[string]interface{}, len(c.Data)+len(keyValPairs)/2)
+	for k, v := range c.Data {
+		data[k] = v
+	}
+	_, err := cmn.AppendKVPs(data, keyValPairs)
+	m := &wsMsg{V: protocolVersion, Ctx: c.Ctx, Data: data}
+	if t, ok := data["target"]; ok {
+		m.Target = fmt.Sprintf("%v", t)
+		delete(data, "target")
+	}
+	return m, err
+}
+
+func sendOnWS(c *clientBody, ws *wsSink, key string, data interface{}, keyValPairs ...interface{}) {
+
+	m, err := c.newMsg(keyValPairs)
+	if err != nil {
+		log.Println("Error appending extra key and values in send Err: ", err)
 	}
+	m.Data[key] = data
+	ws.send(m)
 }
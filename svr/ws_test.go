@@ -0,0 +1,35 @@
+package svr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tiffon/nvlv/svr/gdb"
+	"testing"
+)
+
+func TestToProtoError(t *testing.T) {
+
+	tests := []struct {
+		v    interface{}
+		code string
+	}{
+		{badRequest("argument error: no location given"), codeBadRequest},
+		{fmt.Errorf("wrapped: %w", &protoError{codeNoTarget, "x"}), codeNoTarget},
+		{fmt.Errorf("%w: breakpoint %q", gdb.ErrBadNumber, "1\n"), codeBadRequest},
+		{fmt.Errorf("gdb: program argument 0: %w", gdb.ErrMultiline), codeBadRequest},
+		{gdb.ErrTokenReserved, codeBadRequest},
+		{&gdb.MIError{Cmd: "-break-insert", Msg: "No symbol table"}, codeGdbError},
+		{fmt.Errorf("gdb: -exec-run: %w", context.DeadlineExceeded), codeTimeout},
+		{gdb.ErrNotStarted, codeNotStarted},
+		{gdb.ErrIoEnded, codeGdbExited},
+		{gdb.ErrCantRestart, codeUnsupported},
+		{errors.New("something else"), codeInternal},
+		{"not an error", codeInternal},
+	}
+	for _, tt := range tests {
+		if got := toProtoError(tt.v); got.Code != tt.code {
+			t.Errorf("toProtoError(%v) = %s, want %s", tt.v, got.Code, tt.code)
+		}
+	}
+}